@@ -0,0 +1,80 @@
+package bloom
+
+import (
+	"hash/fnv"
+	"math"
+	"sync"
+)
+
+// Filter is a bloom filter, testing whether a key has been seen before.
+// False positives occur at the configured rate, false negatives don't.
+type Filter struct {
+	m    sync.Mutex
+	bits []uint64
+	size uint64
+	k    uint64
+}
+
+// New returns a filter sized for n keys with false positive rate p.
+func New(n uint64, p float64) *Filter {
+	if n == 0 {
+		n = 1
+	}
+
+	size := uint64(math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2)))
+	size = (size + 63) / 64 * 64
+
+	k := uint64(math.Round(float64(size) / float64(n) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+
+	return &Filter{
+		bits: make([]uint64, size/64),
+		size: size,
+		k:    k,
+	}
+}
+
+// Add adds the key and returns whether it was (probably) seen before.
+func (f *Filter) Add(key string) bool {
+	h := fnv.New128a()
+	h.Write([]byte(key))
+
+	sum := h.Sum(nil)
+
+	// double hashing, the positions are h1 + i*h2
+	h1, h2 := uint64(0), uint64(0)
+	for i := 0; i < 8; i++ {
+		h1 = h1<<8 | uint64(sum[i])
+		h2 = h2<<8 | uint64(sum[8+i])
+	}
+
+	h1, h2 = mix(h1), mix(h2)|1
+
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	seen := true
+	for i := uint64(0); i < f.k; i++ {
+		pos := (h1 + i*h2) % f.size
+
+		word, bit := pos/64, uint64(1)<<(pos%64)
+		if f.bits[word]&bit == 0 {
+			seen = false
+			f.bits[word] |= bit
+		}
+	}
+
+	return seen
+}
+
+// mix is the splitmix64 finalizer, fnv spreads similar keys poorly.
+func mix(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
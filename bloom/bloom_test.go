@@ -0,0 +1,48 @@
+package bloom
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestAdd(t *testing.T) {
+	f := New(1000, 0.01)
+
+	if f.Add("example.com") {
+		t.Error("new key reported as seen")
+	}
+
+	if !f.Add("example.com") {
+		t.Error("added key reported as not seen")
+	}
+}
+
+func TestFalsePositiveRate(t *testing.T) {
+	const n = 100000
+
+	f := New(n, 0.01)
+
+	for i := 0; i < n; i++ {
+		f.Add(fmt.Sprintf("www%d.example.com", i))
+	}
+
+	for i := 0; i < n; i++ {
+		if !f.Add(fmt.Sprintf("www%d.example.com", i)) {
+			t.Fatalf("www%d.example.com reported as not seen", i)
+		}
+	}
+
+	// every tested key is added too, test few keys to keep the load near n
+	const tests = n / 10
+
+	fp := 0
+	for i := 0; i < tests; i++ {
+		if f.Add(fmt.Sprintf("mail%d.example.org", i)) {
+			fp++
+		}
+	}
+
+	if rate := float64(fp) / tests; rate > 0.02 {
+		t.Errorf("false positive rate is %.4f, should be about 0.01", rate)
+	}
+}
@@ -5,7 +5,6 @@ import (
 	"github.com/op/go-logging"
 	"syscall"
 
-	"bufio"
 	"context"
 	"net/http"
 	_ "net/http/pprof"
@@ -14,11 +13,13 @@ import (
 	"os/signal"
 	"strings"
 
-	"github.com/bogdanovich/dns_resolver"
 	"github.com/fatih/color"
+	"github.com/mattn/go-colorable"
 	"github.com/minio/cli"
 
 	"github.com/dutchcoders/anam/config"
+	"github.com/dutchcoders/anam/input"
+	"github.com/dutchcoders/anam/output"
 	"github.com/dutchcoders/anam/scanner"
 )
 
@@ -54,19 +55,182 @@ var globalFlags = []cli.Flag{
 		Usage: "",
 		Value: "www",
 	},
-	// do we want to save the output of the hits?
+	cli.StringFlag{
+		Name:  "prefix-file",
+		Usage: "file with a prefix per line to prepend to the domains",
+		Value: "",
+	},
+	cli.StringFlag{
+		Name:  "input",
+		Usage: "file to read hosts from, plain text or rank,domain csv, optionally gzip, zstd or zip compressed. Defaults to stdin",
+		Value: "",
+	},
+	cli.StringFlag{
+		Name:  "output, o",
+		Usage: "file to write results to, defaults to stdout",
+		Value: "",
+	},
+	cli.StringFlag{
+		Name:  "format, f",
+		Usage: "output format: console, jsonl, csv, ndjson-gzip or sqlite",
+		Value: "",
+	},
 
 	// where shoud we look at (eg. starts with?)
 	cli.StringFlag{
 		Name:  "resolvers",
-		Usage: "",
+		Usage: "comma separated dns resolvers, addresses, tls://host or https://host/dns-query",
+		Value: "",
+	},
+	cli.BoolFlag{
+		Name:  "reverse-dns",
+		Usage: "name hosts from address ranges by their reverse dns name",
+	},
+	cli.BoolFlag{
+		Name:  "ipv6",
+		Usage: "resolve AAAA records and scan ipv6 addresses",
+	},
+	cli.BoolFlag{
+		Name:  "raw-dns",
+		Usage: "send dns queries using the network stack instead of a socket per query",
+	},
+	cli.IntFlag{
+		Name:  "resolver-qps",
+		Usage: "maximum queries per second for every resolver, 0 means unlimited",
+		Value: 0,
+	},
+	cli.IntFlag{
+		Name:  "dns-cache-size",
+		Usage: "amount of names to cache dns answers for, 0 disables the cache",
+		Value: 100000,
+	},
+	cli.IntFlag{
+		Name:  "dns-negative-ttl",
+		Usage: "seconds to cache non existing names and server failures",
+		Value: 60,
+	},
+	cli.IntFlag{
+		Name:  "dns-min-ttl",
+		Usage: "minimum seconds to cache answers, 0 uses the ttl of the records",
+		Value: 0,
+	},
+	cli.IntFlag{
+		Name:  "dns-max-ttl",
+		Usage: "maximum seconds to cache answers, 0 uses the ttl of the records",
+		Value: 0,
+	},
+	cli.StringFlag{
+		Name:  "takeover",
+		Usage: "file with fingerprints of unclaimed resources, to detect dangling cnames",
+		Value: "",
+	},
+	cli.StringSliceFlag{
+		Name:  "exclude",
+		Usage: "file with domains, wildcards (*.example.com) and networks that must never be contacted",
+		Value: &cli.StringSlice{},
+	},
+	cli.StringFlag{
+		Name:  "shard",
+		Usage: "only scan the hosts of shard N/M, to share the input over M machines",
 		Value: "",
 	},
+	cli.IntFlag{
+		Name:  "dedup-size",
+		Usage: "expected amount of unique hosts, to size the deduplication filters. The filters skip about 1 in 1000 unique hosts when full. 0 disables deduplication",
+		Value: 0,
+	},
+	cli.BoolFlag{
+		Name:  "randomize",
+		Usage: "scan hosts in random order, to spread the load over networks",
+	},
+	cli.IntFlag{
+		Name:  "shuffle-buffer",
+		Usage: "amount of input lines to shuffle when randomizing",
+		Value: 10000,
+	},
 	cli.StringFlag{
 		Name:  "user-agent",
 		Usage: "",
 		Value: "ANAM (github.com/dutchcoders/anam)",
 	},
+	cli.StringFlag{
+		Name:  "state-file",
+		Usage: "file to periodically record scan progress in",
+		Value: "",
+	},
+	cli.BoolFlag{
+		Name:  "resume",
+		Usage: "skip hosts already completed according to the state file",
+	},
+	cli.StringFlag{
+		Name:  "config, c",
+		Usage: "yaml configuration file",
+		Value: "",
+	},
+	cli.StringFlag{
+		Name:  "templates",
+		Usage: "directory with yaml probe templates",
+		Value: "",
+	},
+	cli.IntFlag{
+		Name:  "baseline",
+		Usage: "amount of random paths to request per host and method to detect soft-404 responses, once a probe matches. Every baseline path is an extra request. 0 disables",
+		Value: 1,
+	},
+	cli.BoolFlag{
+		Name:  "secrets",
+		Usage: "detect secrets in the body of hits, only redacted values are reported",
+	},
+	cli.StringFlag{
+		Name:   "secrets-key",
+		Usage:  "key of the fingerprints of secrets, fingerprints are comparable across scans using the same key. Defaults to a random key per scan",
+		EnvVar: "ANAM_SECRETS_KEY",
+	},
+	cli.StringFlag{
+		Name:  "verify",
+		Usage: "comma separated verification modules to run on hits: git, svn",
+		Value: "",
+	},
+	cli.StringFlag{
+		Name:  "git-dump",
+		Usage: "directory to reconstruct verified git repositories in",
+		Value: "",
+	},
+	cli.IntFlag{
+		Name:  "git-max-objects",
+		Usage: "maximum amount of git objects to fetch per host",
+		Value: 500,
+	},
+	cli.StringFlag{
+		Name:  "match-status",
+		Usage: "only report responses with these status codes, eg. 200,301-303",
+		Value: "",
+	},
+	cli.StringSliceFlag{
+		Name:  "match-header",
+		Usage: "only report responses with a header matching \"name: expression\"",
+		Value: &cli.StringSlice{},
+	},
+	cli.StringSliceFlag{
+		Name:  "match-body",
+		Usage: "only report responses with a body matching the expression",
+		Value: &cli.StringSlice{},
+	},
+	cli.StringSliceFlag{
+		Name:  "match-string",
+		Usage: "only report responses with a body containing the string",
+		Value: &cli.StringSlice{},
+	},
+	cli.IntFlag{
+		Name:  "min-length",
+		Usage: "only report responses with a body of at least this length",
+		Value: 0,
+	},
+	cli.IntFlag{
+		Name:  "max-length",
+		Usage: "only report responses with a body of at most this length",
+		Value: 0,
+	},
 	cli.BoolFlag{
 		Name:  "profiler",
 		Usage: "enable profiler",
@@ -131,21 +295,35 @@ func New() *App {
 }
 
 func run(c *cli.Context) {
-	cfg := config.LoadFromContext(c)
+	cfg, err := config.LoadFromContext(c)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, color.RedString("Could not load configuration: %s", err.Error()))
+		os.Exit(1)
+	}
+
+	if len(c.Args()) > 0 {
+		cfg.Paths = c.Args()
+	}
 
-	if len(c.Args()) == 0 {
+	if len(cfg.Paths) == 0 && cfg.Templates == "" {
 		// help()
 		os.Exit(1)
 	}
 
-	cfg.Paths = c.Args()
+	if cfg.Resume && cfg.StateFile == "" {
+		fmt.Fprintln(os.Stderr, color.RedString("The resume flag requires a state file."))
+		return
+	}
+
+	// stdout is reserved for results
+	color.Output = colorable.NewColorableStderr()
 
 	color.Green("ANAM: Mass http(s) scanner. (c) Dutchcoders")
 	color.Green("Using interface: %s.", cfg.Interface)
 
 	if c.GlobalBool("profiler") {
 		go func() {
-			fmt.Println(color.YellowString("Starting profiler on :6060."))
+			fmt.Fprintln(os.Stderr, color.YellowString("Starting profiler on :6060."))
 			if err := http.ListenAndServe(":6060", nil); err != nil {
 				panic(err)
 			}
@@ -159,33 +337,47 @@ func run(c *cli.Context) {
 		anam = a
 	}
 
+	if w, err := output.New(cfg); err != nil {
+		fmt.Fprintln(os.Stderr, color.RedString("Could not open output: %s", err.Error()))
+		return
+	} else {
+		defer w.Close()
+
+		anam.SetWriter(w)
+	}
+
 	if servers := c.GlobalString("resolvers"); servers == "" {
-	} else if resolver := dns_resolver.New(strings.Split(servers, ",")); resolver == nil {
+	} else if r, err := anam.NewResolver(strings.Split(servers, ",")); err != nil {
+		fmt.Fprintln(os.Stderr, color.RedString("Could not create resolver: %s", err.Error()))
+		return
 	} else {
-		anam.SetResolver(resolver)
+		anam.SetResolver(r)
 	}
 
-	// reading input from stdin
-	fi, err := os.Stdin.Stat()
-	if err != nil {
+	if cfg.Input != "" && cfg.Input != "-" {
+	} else if fi, err := os.Stdin.Stat(); err != nil {
 		panic(err)
+	} else if fi.Mode()&os.ModeCharDevice != 0 {
+		fmt.Fprintln(os.Stderr, color.RedString("Could not read hosts from stdin, use --input or redirect a file."))
+		return
 	}
 
-	if fi.Mode()&os.ModeNamedPipe == 0 {
-		fmt.Println(color.RedString(fmt.Sprintf("Could not read hosts from stdin.")))
+	in, err := input.Open(cfg.Input)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, color.RedString("Could not open input: %s", err.Error()))
 		return
 	}
 
-	go func() {
-		scanner := bufio.NewScanner(os.Stdin)
+	defer in.Close()
 
+	go func() {
 		feeder := anam.Feed()
-		for scanner.Scan() {
-			feeder <- scanner.Text()
+		for in.Scan() {
+			feeder <- in.Text()
 		}
 
-		if err := scanner.Err(); err != nil {
-			panic(err)
+		if err := in.Err(); err != nil {
+			color.Red("Could not read input: %s", err.Error())
 		}
 
 		close(feeder)
@@ -200,7 +392,7 @@ func run(c *cli.Context) {
 
 		select {
 		case <-s:
-			fmt.Println(color.YellowString(fmt.Sprintf("Aborting scan.")))
+			fmt.Fprintln(os.Stderr, color.YellowString(fmt.Sprintf("Aborting scan.")))
 			cancelFn()
 		}
 	}()
@@ -1,32 +1,154 @@
 package config
 
 import (
+	"io/ioutil"
 	"reflect"
+	"strings"
 
 	"github.com/minio/cli"
+	"gopkg.in/yaml.v2"
+
+	"github.com/dutchcoders/anam/matcher"
 )
 
 type Config struct {
-	UseTLS bool `flag:"tls"`
+	UseTLS bool `flag:"tls" yaml:"tls"`
+
+	Port       int `flag:"port" yaml:"port"`
+	NumThreads int `flag:"threads" yaml:"threads"`
+
+	Interface string `flag:"interface" yaml:"interface"`
+
+	Timeout        int    `flag:"timeout" yaml:"timeout"`
+	UserAgent      string `flag:"user-agent" yaml:"user-agent"`
+	EnableProfiler bool   `flag:"profiler" yaml:"profiler"`
+
+	Resolvers string `flag:"resolvers" yaml:"resolvers"`
+	Prefix    string `flag:"prefix" yaml:"prefix"`
+
+	// ResolverQPS is the maximum of queries per second for every resolver,
+	// 0 means unlimited
+	ResolverQPS int `flag:"resolver-qps" yaml:"resolver-qps"`
+
+	// PrefixFile contains a prefix per line
+	PrefixFile string `flag:"prefix-file" yaml:"prefix-file"`
+
+	ReverseDNS bool `flag:"reverse-dns" yaml:"reverse-dns"`
+
+	// IPv6 resolves AAAA records besides A records
+	IPv6 bool `flag:"ipv6" yaml:"ipv6"`
+
+	// RawDNS sends dns queries using the network stack instead of sockets
+	RawDNS bool `flag:"raw-dns" yaml:"raw-dns"`
+
+	// DNSCacheSize is the amount of names cached, 0 disables the cache
+	DNSCacheSize   int `flag:"dns-cache-size" yaml:"dns-cache-size"`
+	DNSNegativeTTL int `flag:"dns-negative-ttl" yaml:"dns-negative-ttl"`
+
+	// DNSMinTTL and DNSMaxTTL limit the seconds answers are cached, 0 means
+	// the ttl of the records is used
+	DNSMinTTL int `flag:"dns-min-ttl" yaml:"dns-min-ttl"`
+	DNSMaxTTL int `flag:"dns-max-ttl" yaml:"dns-max-ttl"`
+
+	// Takeover is the file with fingerprints of unclaimed resources
+	Takeover string `flag:"takeover" yaml:"takeover"`
 
-	Port       int `flag:"port"`
-	NumThreads int `flag:"threads"`
+	// Exclude contains files with domains, wildcards and networks that
+	// must never be contacted
+	Exclude []string `flag:"exclude" yaml:"exclude"`
 
-	Interface string `flag:"interface"`
+	Shard string `flag:"shard" yaml:"shard"`
 
-	Timeout        int    `flag:"timeout"`
-	UserAgent      string `flag:"user-agent"`
-	EnableProfiler bool   `flag:"profiler"`
+	// DedupSize is the expected amount of unique hosts, 0 disables
+	// deduplication
+	DedupSize int `flag:"dedup-size" yaml:"dedup-size"`
 
-	Resolvers string `flag:"resolvers"`
-	Prefix    string `flag:"prefix"`
+	Randomize     bool `flag:"randomize" yaml:"randomize"`
+	ShuffleBuffer int  `flag:"shuffle-buffer" yaml:"shuffle-buffer"`
+
+	Input  string `flag:"input" yaml:"input"`
+	Output string `flag:"output" yaml:"output"`
+	Format string `flag:"format" yaml:"format"`
+
+	StateFile string `flag:"state-file" yaml:"state-file"`
+	Resume    bool   `flag:"resume" yaml:"resume"`
+
+	MatchStatus string   `flag:"match-status" yaml:"match-status"`
+	MatchHeader []string `flag:"match-header" yaml:"match-header"`
+	MatchBody   []string `flag:"match-body" yaml:"match-body"`
+	MatchString []string `flag:"match-string" yaml:"match-string"`
+	MinLength   int      `flag:"min-length" yaml:"min-length"`
+	MaxLength   int      `flag:"max-length" yaml:"max-length"`
+
+	Templates string `flag:"templates" yaml:"templates"`
+	Baseline  int    `flag:"baseline" yaml:"baseline"`
+
+	DetectSecrets bool `flag:"secrets" yaml:"secrets"`
+
+	// SecretsKey is the key of the fingerprints of secrets, it is never
+	// stored with the results
+	SecretsKey string `flag:"secrets-key" yaml:"secrets-key" json:"-"`
+
+	Verify        string `flag:"verify" yaml:"verify"`
+	GitDump       string `flag:"git-dump" yaml:"git-dump"`
+	GitMaxObjects int    `flag:"git-max-objects" yaml:"git-max-objects"`
+
+	// Matchers contains the matchers per path, from the configuration file
+	Matchers map[string]matcher.Spec `yaml:"matchers"`
+
+	Paths []string `yaml:"paths"`
+}
+
+// MatchSpec returns the matcher described by the match flags, it applies to
+// every path.
+func (c *Config) MatchSpec() (*matcher.Spec, error) {
+	status, err := matcher.ParseStatus(c.MatchStatus)
+	if err != nil {
+		return nil, err
+	}
 
-	Paths []string
+	return &matcher.Spec{
+		Status:    status,
+		Header:    c.MatchHeader,
+		Body:      c.MatchBody,
+		Contains:  c.MatchString,
+		MinLength: c.MinLength,
+		MaxLength: c.MaxLength,
+	}, nil
 }
 
-func LoadFromContext(c *cli.Context) *Config {
+// LoadFromContext returns the configuration from the flags. When a
+// configuration file is given, its values take precedence over the flag
+// defaults, but not over flags set explicitly.
+func LoadFromContext(c *cli.Context) (*Config, error) {
 	config := &Config{}
 
+	apply(c, config, func(string) bool {
+		return true
+	})
+
+	path := c.GlobalString("config")
+	if path == "" {
+		return config, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := yaml.Unmarshal(data, config); err != nil {
+		return nil, err
+	}
+
+	apply(c, config, func(name string) bool {
+		return isSet(c, name)
+	})
+
+	return config, nil
+}
+
+func apply(c *cli.Context, config *Config, filter func(string) bool) {
 	v2 := reflect.ValueOf(config).Elem()
 	v := v2.Type()
 
@@ -38,6 +160,10 @@ func LoadFromContext(c *cli.Context) *Config {
 			continue
 		}
 
+		if !filter(tag) {
+			continue
+		}
+
 		dest := v2.FieldByName(f.Name)
 
 		switch f.Type.Kind() {
@@ -47,7 +173,32 @@ func LoadFromContext(c *cli.Context) *Config {
 			dest.SetInt(int64(c.GlobalInt(tag)))
 		case reflect.String:
 			dest.SetString(c.GlobalString(tag))
+		case reflect.Slice:
+			dest.Set(reflect.ValueOf(c.GlobalStringSlice(tag)))
+		}
+	}
+}
+
+// isSet returns whether the flag has been set explicitly, using any of its
+// names.
+func isSet(c *cli.Context, name string) bool {
+	for _, flag := range c.App.Flags {
+		v := reflect.ValueOf(flag).FieldByName("Name")
+		if !v.IsValid() {
+			continue
+		}
+
+		names := strings.Split(v.String(), ",")
+		if strings.TrimSpace(names[0]) != name {
+			continue
+		}
+
+		for _, n := range names {
+			if c.GlobalIsSet(strings.TrimSpace(n)) {
+				return true
+			}
 		}
 	}
-	return config
+
+	return false
 }
@@ -0,0 +1,184 @@
+package exclude
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+)
+
+type ipRange struct {
+	first, last net.IP
+}
+
+// List contains the hosts and networks that must never be contacted.
+// Domains match themselves and their subdomains, wildcards like
+// *.example.com match every subdomain only, addresses and cidrs match the
+// addresses they contain.
+type List struct {
+	names    map[string]bool
+	suffixes map[string]bool
+	ranges   []ipRange
+}
+
+func New() *List {
+	return &List{
+		names:    map[string]bool{},
+		suffixes: map[string]bool{},
+	}
+}
+
+// Load returns the list with the entries of the files.
+func Load(paths ...string) (*List, error) {
+	l := New()
+
+	for _, path := range paths {
+		if err := l.load(path); err != nil {
+			return nil, err
+		}
+	}
+
+	l.compact()
+	return l, nil
+}
+
+func (l *List) load(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+
+	line := 0
+	for s.Scan() {
+		line++
+
+		text := s.Text()
+		if i := strings.Index(text, "#"); i >= 0 {
+			text = text[:i]
+		}
+
+		text = strings.TrimSpace(text)
+		if text == "" {
+			continue
+		}
+
+		if err := l.add(text); err != nil {
+			return fmt.Errorf("%s:%d: %s", path, line, err.Error())
+		}
+	}
+
+	return s.Err()
+}
+
+func (l *List) add(entry string) error {
+	if ip := net.ParseIP(entry); ip != nil {
+		ip = ip.To16()
+		l.ranges = append(l.ranges, ipRange{ip, ip})
+	} else if strings.Contains(entry, "/") {
+		_, n, err := net.ParseCIDR(entry)
+		if err != nil {
+			return err
+		}
+
+		first, last := n.IP.To16(), make(net.IP, net.IPv6len)
+		mask := n.Mask
+		if len(mask) == net.IPv4len {
+			mask = append(net.CIDRMask(96, 128)[:12], mask...)
+		}
+
+		for i := range first {
+			last[i] = first[i] | ^mask[i]
+		}
+
+		l.ranges = append(l.ranges, ipRange{first, last})
+	} else if strings.HasPrefix(entry, "*.") {
+		l.suffixes[normalize(entry[2:])] = true
+	} else {
+		l.names[normalize(entry)] = true
+	}
+
+	return nil
+}
+
+// compact sorts and merges the ranges, for lookups using binary search.
+func (l *List) compact() {
+	sort.Slice(l.ranges, func(i, j int) bool {
+		return bytes.Compare(l.ranges[i].first, l.ranges[j].first) < 0
+	})
+
+	ranges := l.ranges[:0]
+	for _, r := range l.ranges {
+		if n := len(ranges); n > 0 && bytes.Compare(r.first, ranges[n-1].last) <= 0 {
+			if bytes.Compare(r.last, ranges[n-1].last) > 0 {
+				ranges[n-1].last = r.last
+			}
+
+			continue
+		}
+
+		ranges = append(ranges, r)
+	}
+
+	l.ranges = ranges
+}
+
+// Len returns the amount of entries, overlapping networks count as one.
+func (l *List) Len() int {
+	if l == nil {
+		return 0
+	}
+
+	return len(l.names) + len(l.suffixes) + len(l.ranges)
+}
+
+// MatchName returns true when the name or one of its parent domains is
+// excluded.
+func (l *List) MatchName(name string) bool {
+	if l == nil {
+		return false
+	}
+
+	name = normalize(name)
+	if l.names[name] {
+		return true
+	}
+
+	for i := strings.Index(name, "."); i >= 0; i = strings.Index(name, ".") {
+		name = name[i+1:]
+
+		if l.names[name] || l.suffixes[name] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// MatchIP returns true when the address is within an excluded network.
+func (l *List) MatchIP(ip net.IP) bool {
+	if l == nil {
+		return false
+	}
+
+	ip = ip.To16()
+	if ip == nil {
+		return false
+	}
+
+	i := sort.Search(len(l.ranges), func(i int) bool {
+		return bytes.Compare(l.ranges[i].last, ip) >= 0
+	})
+
+	return i < len(l.ranges) && bytes.Compare(l.ranges[i].first, ip) <= 0
+}
+
+func normalize(name string) string {
+	return strings.TrimSuffix(strings.ToLower(name), ".")
+}
@@ -0,0 +1,81 @@
+package exclude
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func load(t *testing.T, content string) *List {
+	dir, err := ioutil.TempDir("", "exclude")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "optout.txt")
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return l
+}
+
+func TestMatchName(t *testing.T) {
+	l := load(t, "example.com\n*.example.org # wildcard\n")
+
+	for name, expected := range map[string]bool{
+		"example.com":       true,
+		"EXAMPLE.COM.":      true,
+		"www.example.com":   true,
+		"a.b.example.com":   true,
+		"notexample.com":    false,
+		"example.org":       false,
+		"www.example.org":   true,
+		"example.net":       false,
+		"www.example.com.x": false,
+	} {
+		if l.MatchName(name) != expected {
+			t.Errorf("MatchName(%q) should be %v", name, expected)
+		}
+	}
+}
+
+func TestMatchIP(t *testing.T) {
+	l := load(t, "192.0.2.0/24\n192.0.2.128/25\n198.51.100.7\n2001:db8::/32\n")
+
+	for ip, expected := range map[string]bool{
+		"192.0.2.1":       true,
+		"192.0.2.255":     true,
+		"192.0.3.0":       false,
+		"198.51.100.7":    true,
+		"198.51.100.8":    false,
+		"2001:db8::1":     true,
+		"2001:db9::1":     false,
+		"::ffff:c000:201": true,
+	} {
+		if l.MatchIP(net.ParseIP(ip)) != expected {
+			t.Errorf("MatchIP(%s) should be %v", ip, expected)
+		}
+	}
+
+	if l.Len() != 3 {
+		t.Errorf("expected overlapping networks to be merged, got %d entries", l.Len())
+	}
+}
+
+func TestNil(t *testing.T) {
+	var l *List
+
+	if l.MatchName("example.com") || l.MatchIP(net.ParseIP("192.0.2.1")) || l.Len() != 0 {
+		t.Fatal("a nil list should match nothing")
+	}
+}
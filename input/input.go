@@ -0,0 +1,292 @@
+package input
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+var (
+	magicGzip = []byte{0x1f, 0x8b}
+	magicZstd = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	magicZip  = []byte{'P', 'K', 0x03, 0x04}
+)
+
+// Reader reads hosts from plain text or rank,domain csv input, optionally
+// gzip, zstd or zip compressed.
+type Reader struct {
+	s       *bufio.Scanner
+	closers []io.Closer
+
+	text string
+	line int
+}
+
+// Open returns a reader for the file at path, stdin is used when path is
+// empty or "-". The compression is detected by the content.
+func Open(path string) (*Reader, error) {
+	var f *os.File
+	if path == "" || path == "-" {
+		f = os.Stdin
+	} else if v, err := os.Open(path); err != nil {
+		return nil, err
+	} else {
+		f = v
+	}
+
+	// zip archives are read from the file directly, as zip needs random
+	// access
+	magic := make([]byte, len(magicZip))
+	if n, _ := f.ReadAt(magic, 0); n == len(magic) && bytes.Equal(magic, magicZip) {
+		f.Close()
+
+		zr, err := unzip(path)
+		if err != nil {
+			return nil, err
+		}
+
+		r := newReader(zr)
+		r.closers = append(r.closers, zr)
+		return r, nil
+	}
+
+	r, err := NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	if f != os.Stdin {
+		r.closers = append(r.closers, f)
+	}
+
+	return r, nil
+}
+
+// NewReader returns a reader for rd, decompressing it when needed.
+func NewReader(rd io.Reader) (*Reader, error) {
+	br := bufio.NewReader(rd)
+
+	// errors will surface while reading
+	magic, _ := br.Peek(4)
+
+	if bytes.HasPrefix(magic, magicGzip) {
+		if zr, err := gzip.NewReader(br); err != nil {
+			return nil, err
+		} else {
+			r := newReader(zr)
+			r.closers = append(r.closers, zr)
+			return r, nil
+		}
+	} else if bytes.HasPrefix(magic, magicZstd) {
+		if zr, err := zstd.NewReader(br); err != nil {
+			return nil, err
+		} else {
+			r := newReader(zr)
+			r.closers = append(r.closers, zr.IOReadCloser())
+			return r, nil
+		}
+	} else if bytes.HasPrefix(magic, magicZip) {
+		if zr, err := unzipStream(br); err != nil {
+			return nil, err
+		} else {
+			r := newReader(zr)
+			r.closers = append(r.closers, zr)
+			return r, nil
+		}
+	}
+
+	return newReader(br), nil
+}
+
+func newReader(src io.Reader) *Reader {
+	r := &Reader{
+		s: bufio.NewScanner(src),
+	}
+
+	r.s.Buffer(make([]byte, 64*1024), 1024*1024)
+	return r
+}
+
+// zipReader reads the concatenated files of an archive, opening a file
+// when the previous one has been read.
+type zipReader struct {
+	zr    *zip.ReadCloser
+	files []*zip.File
+	cur   io.ReadCloser
+
+	// a newline is due after each file
+	newline bool
+}
+
+// unzip returns a reader for the files of the archive at path.
+func unzip(path string) (*zipReader, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &zipReader{
+		zr: zr,
+	}
+
+	for _, f := range zr.File {
+		if !f.FileInfo().IsDir() {
+			r.files = append(r.files, f)
+		}
+	}
+
+	return r, nil
+}
+
+// unzipStream copies the archive to a temporary file, which is removed
+// right away but stays readable until closed.
+func unzipStream(rd io.Reader) (*zipReader, error) {
+	tmp, err := ioutil.TempFile("", "anam-input.zip")
+	if err != nil {
+		return nil, err
+	}
+
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, rd); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+
+	return unzip(tmp.Name())
+}
+
+func (r *zipReader) Read(p []byte) (int, error) {
+	for {
+		if r.newline && len(p) > 0 {
+			// files may lack a trailing newline
+			r.newline = false
+			p[0] = '\n'
+			return 1, nil
+		}
+
+		if r.cur != nil {
+		} else if len(r.files) == 0 {
+			return 0, io.EOF
+		} else if fr, err := r.files[0].Open(); err != nil {
+			return 0, err
+		} else {
+			r.cur = fr
+			r.files = r.files[1:]
+		}
+
+		n, err := r.cur.Read(p)
+		if err != io.EOF {
+			return n, err
+		}
+
+		err = r.cur.Close()
+		r.cur, r.newline = nil, true
+
+		if err != nil || n > 0 {
+			return n, err
+		}
+	}
+}
+
+func (r *zipReader) Close() error {
+	if r.cur != nil {
+		r.cur.Close()
+		r.cur = nil
+	}
+
+	return r.zr.Close()
+}
+
+// Scan advances to the next host, empty lines, comments and csv headers are
+// skipped.
+func (r *Reader) Scan() bool {
+	for r.s.Scan() {
+		r.line++
+
+		if text, ok := parseLine(r.s.Text(), r.line == 1); ok {
+			r.text = text
+			return true
+		}
+	}
+
+	return false
+}
+
+// Text returns the current host.
+func (r *Reader) Text() string {
+	return r.text
+}
+
+func (r *Reader) Err() error {
+	return r.s.Err()
+}
+
+func (r *Reader) Close() error {
+	var err error
+	for i := len(r.closers) - 1; i >= 0; i-- {
+		if cerr := r.closers[i].Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+
+	return err
+}
+
+// parseLine returns the host of the line. For csv lines in the rank,domain
+// format (alexa, tranco) the domain is returned, for other csv lines the
+// first column.
+func parseLine(line string, first bool) (string, bool) {
+	line = strings.TrimSpace(line)
+	if first {
+		// byte order mark
+		line = strings.TrimPrefix(line, "\ufeff")
+	}
+
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", false
+	}
+
+	parts := strings.Split(line, ",")
+	if len(parts) == 1 || strings.Contains(line, "://") {
+		// urls may contain commas
+		return line, true
+	} else if isNumber(parts[0]) {
+		host := strings.TrimSpace(parts[1])
+		return host, host != ""
+	} else if first && !strings.ContainsAny(parts[0], ".:") {
+		// header, eg. rank,domain
+		return "", false
+	}
+
+	// other csv, the host is the first column
+	host := strings.TrimSpace(parts[0])
+	return host, host != ""
+}
+
+func isNumber(s string) bool {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return false
+	}
+
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,194 @@
+package input
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestParseLine(t *testing.T) {
+	for _, c := range []struct {
+		line  string
+		first bool
+		host  string
+		ok    bool
+	}{
+		{"example.com", false, "example.com", true},
+		{"  example.com\t", false, "example.com", true},
+		{"\ufeffexample.com", true, "example.com", true},
+		{"", false, "", false},
+		{"   ", false, "", false},
+		{"# comment", false, "", false},
+		// rank,domain
+		{"1,google.com", true, "google.com", true},
+		{"42, example.com ", false, "example.com", true},
+		{"42,", false, "", false},
+		{"rank,domain", true, "", false},
+		// other csv
+		{"example.com,192.0.2.1,extra", false, "example.com", true},
+		{"example.com,192.0.2.1", true, "example.com", true},
+		{"192.0.2.1,example.com", false, "192.0.2.1", true},
+		{"domain,ip", true, "", false},
+		{",example.com", false, "", false},
+		// urls are kept whole
+		{"https://example.com/a,b", false, "https://example.com/a,b", true},
+	} {
+		host, ok := parseLine(c.line, c.first)
+		if host != c.host || ok != c.ok {
+			t.Errorf("parseLine(%q, %v) is %q %v, should be %q %v", c.line, c.first, host, ok, c.host, c.ok)
+		}
+	}
+}
+
+const hosts = "rank,domain\n1,google.com\n2,example.com\n\nexample.org"
+
+var expected = []string{"google.com", "example.com", "example.org"}
+
+func read(t *testing.T, r *Reader, err error) []string {
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer r.Close()
+
+	lines := []string{}
+	for r.Scan() {
+		lines = append(lines, r.Text())
+	}
+
+	if err := r.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return lines
+}
+
+func gzipped(t *testing.T, data string) []byte {
+	buf := &bytes.Buffer{}
+
+	zw := gzip.NewWriter(buf)
+	zw.Write([]byte(data))
+
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func zstded(t *testing.T, data string) []byte {
+	buf := &bytes.Buffer{}
+
+	zw, err := zstd.NewWriter(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	zw.Write([]byte(data))
+
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+// zipped returns an archive with the lines spread over two files, both
+// without a trailing newline, and a directory.
+func zipped(t *testing.T) []byte {
+	buf := &bytes.Buffer{}
+
+	zw := zip.NewWriter(buf)
+
+	for _, f := range []struct{ name, data string }{
+		{"a.csv", "rank,domain\n1,google.com\n2,example.com"},
+		{"dir/", ""},
+		{"dir/b.txt", "example.org"},
+	} {
+		w, err := zw.Create(f.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		w.Write([]byte(f.data))
+	}
+
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestNewReader(t *testing.T) {
+	for k, v := range map[string][]byte{
+		"plain": []byte(hosts),
+		"gzip":  gzipped(t, hosts),
+		"zstd":  zstded(t, hosts),
+		"zip":   zipped(t),
+	} {
+		r, err := NewReader(bytes.NewReader(v))
+		if lines := read(t, r, err); !reflect.DeepEqual(lines, expected) {
+			t.Errorf("%s: read %q, should be %q", k, lines, expected)
+		}
+	}
+}
+
+func TestOpen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "anam-input")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	for k, v := range map[string][]byte{
+		"hosts.txt":     []byte(hosts),
+		"hosts.txt.gz":  gzipped(t, hosts),
+		"hosts.txt.zst": zstded(t, hosts),
+		"hosts.zip":     zipped(t),
+		// detected by the content, not the extension
+		"hosts": zipped(t),
+	} {
+		path := filepath.Join(dir, k)
+		if err := ioutil.WriteFile(path, v, 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		r, err := Open(path)
+		if lines := read(t, r, err); !reflect.DeepEqual(lines, expected) {
+			t.Errorf("%s: read %q, should be %q", k, lines, expected)
+		}
+	}
+
+	if _, err := Open(filepath.Join(dir, "missing")); err == nil {
+		t.Error("opening a missing file should fail")
+	}
+}
+
+func TestZipClose(t *testing.T) {
+	r, err := NewReader(bytes.NewReader(zipped(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// closing halfway closes the open file of the archive
+	if !r.Scan() {
+		t.Fatal(r.Err())
+	}
+
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,161 @@
+// Package matcher decides which responses are interesting enough to be
+// reported.
+package matcher
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Response is the part of a http response matchers are evaluated against.
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+type Matcher interface {
+	Match(*Response) bool
+}
+
+// Status matches responses with one of the status codes.
+type Status []int
+
+func (m Status) Match(r *Response) bool {
+	for _, code := range m {
+		if r.StatusCode == code {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Header matches responses with a header value matching the expression.
+type Header struct {
+	Name  string
+	Value *regexp.Regexp
+}
+
+func (m *Header) Match(r *Response) bool {
+	for _, v := range r.Header[http.CanonicalHeaderKey(m.Name)] {
+		if m.Value.MatchString(v) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Body matches responses with a body matching the expression.
+type Body struct {
+	*regexp.Regexp
+}
+
+func (m *Body) Match(r *Response) bool {
+	return m.Regexp.Match(r.Body)
+}
+
+// Contains matches responses with a body containing the substring.
+type Contains []byte
+
+func (m Contains) Match(r *Response) bool {
+	return bytes.Contains(r.Body, m)
+}
+
+// Length matches responses with a body length within bounds, a zero bound
+// is not checked.
+type Length struct {
+	Min int
+	Max int
+}
+
+func (m *Length) Match(r *Response) bool {
+	if m.Min > 0 && len(r.Body) < m.Min {
+		return false
+	}
+
+	if m.Max > 0 && len(r.Body) > m.Max {
+		return false
+	}
+
+	return true
+}
+
+// And matches when all matchers match.
+type And []Matcher
+
+func (m And) Match(r *Response) bool {
+	for _, sub := range m {
+		if !sub.Match(r) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Or matches when any of the matchers match.
+type Or []Matcher
+
+func (m Or) Match(r *Response) bool {
+	for _, sub := range m {
+		if sub.Match(r) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Not inverts a matcher.
+type Not struct {
+	Matcher
+}
+
+func (m *Not) Match(r *Response) bool {
+	return !m.Matcher.Match(r)
+}
+
+// ParseStatus parses a comma separated list of status codes and ranges,
+// eg. "200,301-303". Codes need to be between 100 and 599.
+func ParseStatus(s string) ([]int, error) {
+	codes := []int{}
+
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		bounds := strings.SplitN(part, "-", 2)
+
+		from, err := strconv.Atoi(bounds[0])
+		if err != nil {
+			return nil, fmt.Errorf("Invalid status code: %s", part)
+		}
+
+		to := from
+		if len(bounds) == 2 {
+			if to, err = strconv.Atoi(bounds[1]); err != nil {
+				return nil, fmt.Errorf("Invalid status code: %s", part)
+			}
+		}
+
+		if from < 100 || to > 599 {
+			return nil, fmt.Errorf("Invalid status code, expected 100 to 599: %s", part)
+		} else if from > to {
+			return nil, fmt.Errorf("Invalid status code range: %s", part)
+		}
+
+		for code := from; code <= to; code++ {
+			codes = append(codes, code)
+		}
+	}
+
+	return codes, nil
+}
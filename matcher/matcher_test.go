@@ -0,0 +1,96 @@
+package matcher
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestParseStatus(t *testing.T) {
+	for s, expected := range map[string][]int{
+		"":             {},
+		"200":          {200},
+		"200, 301-303": {200, 301, 302, 303},
+		"404,":         {404},
+	} {
+		codes, err := ParseStatus(s)
+		if err != nil {
+			t.Errorf("ParseStatus(%q): %s", s, err)
+		} else if !reflect.DeepEqual(codes, expected) {
+			t.Errorf("ParseStatus(%q) is %v, should be %v", s, codes, expected)
+		}
+	}
+
+	for _, s := range []string{"ok", "200-", "-200", "200-x", "200-100", "0-2000000000", "99", "600", "500-600"} {
+		if _, err := ParseStatus(s); err == nil {
+			t.Errorf("ParseStatus(%q) should fail", s)
+		}
+	}
+}
+
+func TestCompile(t *testing.T) {
+	spec := Spec{
+		Status: []int{200},
+		Header: []string{"Content-Type: ^text/plain"},
+		Or: []Spec{
+			{Body: []string{"^ref: refs/"}},
+			{Contains: []string{"[core]"}},
+		},
+		Not: &Spec{
+			Body: []string{"(?i)<html"},
+		},
+	}
+
+	m, err := spec.Compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response := func(status int, contentType, body string) *Response {
+		return &Response{
+			StatusCode: status,
+			Header:     http.Header{"Content-Type": {contentType}},
+			Body:       []byte(body),
+		}
+	}
+
+	for _, c := range []struct {
+		r        *Response
+		expected bool
+	}{
+		{response(200, "text/plain", "ref: refs/heads/master\n"), true},
+		{response(200, "text/plain", "[core]\n\tbare = false\n"), true},
+		{response(404, "text/plain", "ref: refs/heads/master\n"), false},
+		{response(200, "text/html", "ref: refs/heads/master\n"), false},
+		{response(200, "text/plain", "not found"), false},
+		{response(200, "text/plain", "[core]<HTML>"), false},
+	} {
+		if m.Match(c.r) != c.expected {
+			t.Errorf("%d %s %q should match: %v", c.r.StatusCode, c.r.Header.Get("Content-Type"), c.r.Body, c.expected)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, spec := range []Spec{
+		{Header: []string{"Content-Type"}},
+		{Body: []string{"("}},
+		{Or: []Spec{{Body: []string{"["}}}},
+		{Not: &Spec{Header: []string{"Server: ("}}},
+	} {
+		if _, err := spec.Compile(); err == nil {
+			t.Errorf("%+v should fail to compile", spec)
+		}
+	}
+}
+
+func TestCompileEmpty(t *testing.T) {
+	m, err := (&Spec{}).Compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !m.Match(&Response{StatusCode: 500}) {
+		t.Error("empty spec should match every response")
+	}
+}
@@ -0,0 +1,114 @@
+package matcher
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Spec describes a matcher as found in the configuration file. All
+// conditions that are set need to match.
+//
+//	status: [200]
+//	header: ["Content-Type: text/plain"]
+//	body: ["^ref: refs/"]
+//	not:
+//	  contains: ["<html"]
+type Spec struct {
+	Status    []int    `yaml:"status"`
+	Header    []string `yaml:"header"`
+	Body      []string `yaml:"body"`
+	Contains  []string `yaml:"contains"`
+	MinLength int      `yaml:"min-length"`
+	MaxLength int      `yaml:"max-length"`
+
+	And []Spec `yaml:"and"`
+	Or  []Spec `yaml:"or"`
+	Not *Spec  `yaml:"not"`
+}
+
+// Compile returns the matcher for the spec. An empty spec matches every
+// response.
+func (s *Spec) Compile() (Matcher, error) {
+	m := And{}
+
+	if len(s.Status) > 0 {
+		m = append(m, Status(s.Status))
+	}
+
+	for _, h := range s.Header {
+		parts := strings.SplitN(h, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("Invalid header matcher, expected \"name: expression\": %s", h)
+		}
+
+		re, err := regexp.Compile(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, err
+		}
+
+		m = append(m, &Header{
+			Name:  strings.TrimSpace(parts[0]),
+			Value: re,
+		})
+	}
+
+	for _, expr := range s.Body {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, err
+		}
+
+		m = append(m, &Body{re})
+	}
+
+	for _, str := range s.Contains {
+		m = append(m, Contains(str))
+	}
+
+	if s.MinLength > 0 || s.MaxLength > 0 {
+		m = append(m, &Length{
+			Min: s.MinLength,
+			Max: s.MaxLength,
+		})
+	}
+
+	for i := range s.And {
+		sub, err := s.And[i].Compile()
+		if err != nil {
+			return nil, err
+		}
+
+		m = append(m, sub)
+	}
+
+	if len(s.Or) > 0 {
+		or := Or{}
+
+		for i := range s.Or {
+			sub, err := s.Or[i].Compile()
+			if err != nil {
+				return nil, err
+			}
+
+			or = append(or, sub)
+		}
+
+		m = append(m, or)
+	}
+
+	if s.Not != nil {
+		sub, err := s.Not.Compile()
+		if err != nil {
+			return nil, err
+		}
+
+		m = append(m, &Not{sub})
+	}
+
+	if len(m) == 1 {
+		return m[0], nil
+	}
+
+	return m, nil
+}
@@ -0,0 +1,78 @@
+package netstack
+
+import (
+	"encoding/binary"
+	"net"
+)
+
+// sum adds data as 16 bit big endian words to s.
+func sum(s uint32, data []byte) uint32 {
+	for i := 0; i+1 < len(data); i += 2 {
+		s += uint32(binary.BigEndian.Uint16(data[i:]))
+	}
+
+	if len(data)%2 == 1 {
+		s += uint32(data[len(data)-1]) << 8
+	}
+
+	return s
+}
+
+// fold returns the ones' complement of the folded sum.
+func fold(s uint32) uint16 {
+	for s > 0xffff {
+		s = (s >> 16) + (s & 0xffff)
+	}
+
+	return ^uint16(s)
+}
+
+// pseudoHeaderSum returns the sum of the pseudo header used by tcp and udp
+// checksums, for ipv4 (rfc 793) or ipv6 (rfc 8200) depending on the
+// addresses.
+func pseudoHeaderSum(src, dst net.IP, proto int, length int) uint32 {
+	s := uint32(0)
+
+	if src4, dst4 := src.To4(), dst.To4(); src4 != nil && dst4 != nil {
+		s = sum(s, src4)
+		s = sum(s, dst4)
+	} else {
+		s = sum(s, src.To16())
+		s = sum(s, dst.To16())
+		s += uint32(length) >> 16
+	}
+
+	s += uint32(proto)
+	s += uint32(length) & 0xffff
+	return s
+}
+
+// transportChecksum sets the checksum of the tcp segment or udp datagram in
+// data.
+func transportChecksum(src, dst net.IP, proto int, data []byte) {
+	offset := 0
+
+	switch proto {
+	case 6 /* tcp */ :
+		offset = 16
+	case 17 /* udp */ :
+		offset = 6
+	default:
+		return
+	}
+
+	if len(data) < offset+2 {
+		return
+	}
+
+	data[offset] = 0
+	data[offset+1] = 0
+
+	csum := fold(sum(pseudoHeaderSum(src, dst, proto, len(data)), data))
+	if csum == 0 && proto == 17 {
+		// zero means no checksum for udp (rfc 768)
+		csum = 0xffff
+	}
+
+	binary.BigEndian.PutUint16(data[offset:], csum)
+}
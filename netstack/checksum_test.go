@@ -0,0 +1,99 @@
+package netstack
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+)
+
+func TestFold(t *testing.T) {
+	// example of rfc 1071
+	data := []byte{0x00, 0x01, 0xf2, 0x03, 0xf4, 0xf5, 0xf6, 0xf7}
+	if csum := fold(sum(0, data)); csum != ^uint16(0xddf2) {
+		t.Errorf("checksum is %#04x, should be %#04x", csum, ^uint16(0xddf2))
+	}
+
+	// odd lengths are padded with zero
+	if s := sum(0, []byte{0x01, 0x02, 0x03}); s != 0x0102+0x0300 {
+		t.Errorf("sum is %#x, should be %#x", s, 0x0102+0x0300)
+	}
+}
+
+func TestIPv4Checksum(t *testing.T) {
+	header := []byte{
+		0x45, 0x00, 0x00, 0x73, 0x00, 0x00, 0x40, 0x00, 0x40, 0x11,
+		0x00, 0x00, 0xc0, 0xa8, 0x00, 0x01, 0xc0, 0xa8, 0x00, 0xc7,
+	}
+
+	if csum := fold(sum(0, header)); csum != 0xb861 {
+		t.Errorf("checksum is %#04x, should be 0xb861", csum)
+	}
+}
+
+func udpDatagram(payload []byte) []byte {
+	data := make([]byte, 8+len(payload))
+	binary.BigEndian.PutUint16(data[0:], 61000)
+	binary.BigEndian.PutUint16(data[2:], 53)
+	binary.BigEndian.PutUint16(data[4:], uint16(len(data)))
+	copy(data[8:], payload)
+	return data
+}
+
+func TestUDPChecksum(t *testing.T) {
+	for _, c := range []struct {
+		src, dst string
+		csum     uint16
+	}{
+		{"192.0.2.2", "192.0.2.1", 0xca78},
+		{"fd00::2", "fd00::1", 0x5478},
+	} {
+		src, dst := net.ParseIP(c.src), net.ParseIP(c.dst)
+
+		data := udpDatagram([]byte("anam"))
+		transportChecksum(src, dst, 17, data)
+
+		if csum := binary.BigEndian.Uint16(data[6:]); csum != c.csum {
+			t.Errorf("%s > %s: checksum is %#04x, should be %#04x", c.src, c.dst, csum, c.csum)
+		}
+
+		// the receiver sums to zero
+		if csum := fold(sum(pseudoHeaderSum(src, dst, 17, len(data)), data)); csum != 0 {
+			t.Errorf("%s > %s: verification is %#04x, should be 0", c.src, c.dst, csum)
+		}
+	}
+}
+
+func TestUDPChecksumZero(t *testing.T) {
+	src, dst := net.ParseIP("192.0.2.2"), net.ParseIP("192.0.2.1")
+
+	// choose the payload so the checksum computes to zero
+	data := udpDatagram([]byte{0, 0})
+	s := ^fold(sum(pseudoHeaderSum(src, dst, 17, len(data)), data))
+	binary.BigEndian.PutUint16(data[8:], 0xffff-s)
+
+	transportChecksum(src, dst, 17, data)
+
+	if csum := binary.BigEndian.Uint16(data[6:]); csum != 0xffff {
+		t.Errorf("checksum is %#04x, should be sent as 0xffff", csum)
+	}
+}
+
+func TestTCPChecksum(t *testing.T) {
+	src, dst := net.ParseIP("fd00::2"), net.ParseIP("fd00::1")
+
+	data := make([]byte, 20)
+	binary.BigEndian.PutUint16(data[0:], 61000)
+	binary.BigEndian.PutUint16(data[2:], 80)
+	data[12] = 5 << 4
+	data[13] = 0x02 // syn
+
+	transportChecksum(src, dst, 6, data)
+
+	if binary.BigEndian.Uint16(data[16:]) == 0 {
+		t.Error("checksum is not set")
+	}
+
+	if csum := fold(sum(pseudoHeaderSum(src, dst, 6, len(data)), data)); csum != 0 {
+		t.Errorf("verification is %#04x, should be 0", csum)
+	}
+}
@@ -5,10 +5,10 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"os"
 	"time"
 
-	ipv4 "github.com/dutchcoders/netstack/ipv4"
-	tcp "github.com/dutchcoders/netstack/tcp"
+	tcp "github.com/dutchcoders/anam/netstack/tcp"
 )
 
 type Connection struct {
@@ -43,7 +43,7 @@ func (conn *Connection) Read(b []byte) (n int, err error) {
 
 	select {
 	case <-time.After(30 * time.Second):
-		fmt.Println("Timeout occured")
+		fmt.Fprintln(os.Stderr, "Timeout occured")
 		return 0, errors.New("Timeout occured.")
 	case _, ok := <-conn.Recv:
 		if !ok {
@@ -70,20 +70,6 @@ func (c *Connection) Write(b []byte) (n int, err error) {
 	state.Lock()
 	defer state.Unlock()
 
-	iph := ipv4.Header{
-		Version:  4,
-		Len:      20,
-		TOS:      0,
-		TotalLen: 52 + len(b),
-		Flags:    2,
-		TTL:      128,
-		Protocol: 6,
-		Src:      c.Src,
-		Dst:      c.Dst,
-		Options:  []byte{},
-		ID:       state.ID,
-	}
-
 	th := tcp.Header{
 		Source:      c.SourcePort,
 		Destination: c.DestinationPort,
@@ -100,15 +86,7 @@ func (c *Connection) Write(b []byte) (n int, err error) {
 		Payload:     b,
 	}
 
-	if data, err := th.Marshal(); err == nil {
-		iph.Payload = data
-	} else {
-		return 0, err
-	}
-
-	if data, err := iph.Marshal(); err == nil {
-		c.Stack.send(data)
-	} else {
+	if err := c.Stack.sendTCP(c.Src, c.Dst, state.ID, &th); err != nil {
 		return 0, err
 	}
 
@@ -192,20 +170,6 @@ func (c *Connection) Close() error {
 
 	c.closing = true
 
-	iph := ipv4.Header{
-		Version:  4,
-		Len:      20,
-		TOS:      0,
-		TotalLen: 52,
-		Flags:    2,
-		TTL:      128,
-		Protocol: 6,
-		Src:      c.Src,
-		Dst:      c.Dst,
-		Options:  []byte{},
-		ID:       state.ID,
-	}
-
 	th := tcp.Header{
 		Source:      c.SourcePort,
 		Destination: c.DestinationPort,
@@ -224,16 +188,8 @@ func (c *Connection) Close() error {
 
 	c.current.SocketState = SocketFinWait1
 
-	if data, err := th.Marshal(); err != nil {
+	if err := c.Stack.sendTCP(c.Src, c.Dst, state.ID, &th); err != nil {
 		return err
-	} else {
-		iph.Payload = data
-	}
-
-	if data, err := iph.Marshal(); err != nil {
-		return err
-	} else {
-		c.Stack.send(data)
 	}
 
 	state.ID++
@@ -283,20 +239,6 @@ func (c *Connection) Open(src net.IP, dst net.IP, port int) error {
 
 	state.SocketState = SocketSynSent
 
-	iph := ipv4.Header{
-		Version:  4,
-		Len:      20,
-		TOS:      0,
-		TotalLen: 52,
-		Flags:    2,
-		TTL:      128,
-		Protocol: 6,
-		Src:      src,
-		Dst:      dst,
-		Options:  []byte{},
-		ID:       id,
-	}
-
 	th := tcp.Header{
 		Source:      c.SourcePort,
 		Destination: c.DestinationPort,
@@ -319,15 +261,7 @@ func (c *Connection) Open(src net.IP, dst net.IP, port int) error {
 	// nop
 	// Window scale
 
-	if data, err := th.Marshal(); err == nil {
-		iph.Payload = data
-	} else {
-		return err
-	}
-
-	if data, err := iph.Marshal(); err == nil {
-		c.Stack.send(data)
-	} else {
+	if err := c.Stack.sendTCP(src, dst, id, &th); err != nil {
 		return err
 	}
 
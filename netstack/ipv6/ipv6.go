@@ -0,0 +1,128 @@
+package ipv6
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+)
+
+const (
+	Version   = 6  // protocol version
+	HeaderLen = 40 // header length without extension headers
+)
+
+var (
+	errMissingAddress = errors.New("missing address")
+	errHeaderTooShort = errors.New("header too short")
+	errInvalidVersion = errors.New("invalid version")
+)
+
+// A Header represents an IPv6 header. Extension headers are not supported,
+// the payload follows the header directly.
+type Header struct {
+	Version      int    // protocol version
+	TrafficClass int    // traffic class
+	FlowLabel    int    // flow label
+	PayloadLen   int    // payload length
+	NextHeader   int    // next header
+	HopLimit     int    // hop limit
+	Src          net.IP // source address
+	Dst          net.IP // destination address
+
+	Payload []byte
+}
+
+func New() *Header {
+	return &Header{
+		Version:    6,
+		NextHeader: 6,
+		HopLimit:   128,
+	}
+}
+
+func (h *Header) WithSource(v net.IP) *Header {
+	h.Src = v
+	return h
+}
+
+func (h *Header) WithDestination(v net.IP) *Header {
+	h.Dst = v
+	return h
+}
+
+func (h *Header) String() string {
+	if h == nil {
+		return "<nil>"
+	}
+	return fmt.Sprintf("ver=%d tclass=%#x flowlbl=%#x payloadlen=%d nxthdr=%d hoplim=%d src=%v dst=%v", h.Version, h.TrafficClass, h.FlowLabel, h.PayloadLen, h.NextHeader, h.HopLimit, h.Src, h.Dst)
+}
+
+// Marshal returns the binary encoding of the IPv6 header h, followed by the
+// payload.
+func (h *Header) Marshal() ([]byte, error) {
+	if h == nil {
+		return nil, syscall.EINVAL
+	}
+
+	h.PayloadLen = len(h.Payload)
+
+	b := make([]byte, HeaderLen+len(h.Payload))
+	binary.BigEndian.PutUint32(b[0:4], uint32(Version)<<28|uint32(h.TrafficClass&0xff)<<20|uint32(h.FlowLabel&0xfffff))
+	binary.BigEndian.PutUint16(b[4:6], uint16(h.PayloadLen))
+	b[6] = byte(h.NextHeader)
+	b[7] = byte(h.HopLimit)
+
+	if ip := h.Src.To16(); ip != nil && h.Src.To4() == nil {
+		copy(b[8:24], ip)
+	} else {
+		return nil, errMissingAddress
+	}
+
+	if ip := h.Dst.To16(); ip != nil && h.Dst.To4() == nil {
+		copy(b[24:40], ip)
+	} else {
+		return nil, errMissingAddress
+	}
+
+	copy(b[HeaderLen:], h.Payload)
+
+	return b, nil
+}
+
+// Parse parses b as an IPv6 header.
+func Parse(b []byte) (*Header, error) {
+	h := &Header{}
+	return h, h.Unmarshal(b)
+}
+
+func (h *Header) Unmarshal(b []byte) error {
+	if len(b) < HeaderLen {
+		return errHeaderTooShort
+	}
+
+	v := binary.BigEndian.Uint32(b[0:4])
+
+	h.Version = int(v >> 28)
+	if h.Version != Version {
+		return errInvalidVersion
+	}
+
+	h.TrafficClass = int(v >> 20 & 0xff)
+	h.FlowLabel = int(v & 0xfffff)
+	h.PayloadLen = int(binary.BigEndian.Uint16(b[4:6]))
+	h.NextHeader = int(b[6])
+	h.HopLimit = int(b[7])
+	h.Src = net.IP(append([]byte{}, b[8:24]...))
+	h.Dst = net.IP(append([]byte{}, b[24:40]...))
+
+	end := HeaderLen + h.PayloadLen
+	if end > len(b) {
+		end = len(b)
+	}
+
+	h.Payload = b[HeaderLen:end]
+
+	return nil
+}
@@ -1,12 +1,13 @@
-package netstack
-
 // +build amd64,linux
 
+package netstack
+
 import (
 	"fmt"
 	"log"
 	"math/rand"
 	_ "net/http/pprof"
+	"os"
 	"strconv"
 	"strings"
 	"time"
@@ -69,7 +70,7 @@ func (ss SocketState) String() string {
 func to4byte(addr string) [4]byte {
 	parts := strings.Split(addr, ".")
 	b0, err := strconv.Atoi(parts[0])
-	fmt.Println(addr)
+	fmt.Fprintln(os.Stderr, addr)
 	if err != nil {
 		log.Fatalf("to4byte: %s (latency works with IPv4 addresses only, but not IPv6!)\n", err)
 	}
@@ -5,12 +5,14 @@ import (
 	"fmt"
 	"math/rand"
 	"net"
+	"os"
 	"sync"
 	"syscall"
 	"time"
 
-	ipv4 "github.com/dutchcoders/netstack/ipv4"
-	tcp "github.com/dutchcoders/netstack/tcp"
+	ipv4 "github.com/dutchcoders/anam/netstack/ipv4"
+	ipv6 "github.com/dutchcoders/anam/netstack/ipv6"
+	tcp "github.com/dutchcoders/anam/netstack/tcp"
 )
 
 func htons(n uint16) uint16 {
@@ -21,23 +23,43 @@ func htons(n uint16) uint16 {
 	return ret
 }
 
+// ipv6HdrIncl is IPV6_HDRINCL, available since linux 4.5
+const ipv6HdrIncl = 36
+
+// udpReceiveBuffer is the size of the receive buffer of the udp sockets
+const udpReceiveBuffer = 8 * 1024 * 1024
+
 type Stack struct {
 	fd   int
 	epfd int
 	r    *rand.Rand
 
+	// fd6 is -1 when ipv6 isn't available
+	fd6 int
+
+	// raw udp sockets, only used for receiving and opened for the first
+	// udp handler. They are -1 otherwise.
+	fdUDP  int
+	fdUDP6 int
+
+	udpm        sync.RWMutex
+	udpHandlers []UDPHandler
+
 	m sync.Mutex
 
 	sendQueue [][]byte
 	buffer    []byte
 
-	src net.IP
+	src  net.IP
+	src6 net.IP
 
 	networkInterface *net.Interface
 }
 
 var ErrNoState = errors.New("No state for packet.")
 
+var ErrNoIPv6 = errors.New("No ipv6 address available on interface.")
+
 func New(intf string) (*Stack, error) {
 	if networkInterface, err := net.InterfaceByName(intf); err != nil {
 		return nil, fmt.Errorf("The selected network interface %s does not exist.\n", intf)
@@ -59,14 +81,114 @@ func New(intf string) (*Stack, error) {
 	} else {
 		r := rand.New(rand.NewSource(time.Now().UTC().UnixNano()))
 
-		return &Stack{
+		s := &Stack{
 			fd:               fd,
+			fd6:              -1,
+			fdUDP:            -1,
+			fdUDP6:           -1,
 			epfd:             epfd,
 			r:                r,
-			src:              addrs[0].(*net.IPNet).IP,
 			networkInterface: networkInterface,
-		}, nil
+		}
+
+		for _, addr := range addrs {
+			ipnet, ok := addr.(*net.IPNet)
+			if !ok {
+			} else if ip := ipnet.IP.To4(); ip != nil {
+				if s.src == nil {
+					s.src = ip
+				}
+			} else if ipnet.IP.IsGlobalUnicast() && s.src6 == nil {
+				s.src6 = ipnet.IP
+			}
+		}
+
+		if s.src == nil && s.src6 == nil {
+			return nil, fmt.Errorf("The selected network interface %s has no ip addresses.\n", intf)
+		}
+
+		if s.src6 == nil {
+		} else if err := s.open6(); err != nil {
+			fmt.Fprintf(os.Stderr, "Could not open ipv6 socket, ipv6 disabled: %s\n", err.Error())
+			s.src6 = nil
+		}
+
+		return s, nil
+	}
+}
+
+// open6 creates the raw ipv6 socket, the ip headers are included in the
+// packets like with ipv4. Udp packets are sent using the tcp socket.
+func (s *Stack) open6() error {
+	fd, err := syscall.Socket(syscall.AF_INET6, syscall.SOCK_RAW, syscall.IPPROTO_TCP)
+	if err != nil {
+		return err
 	}
+
+	if err := syscall.SetsockoptInt(fd, syscall.IPPROTO_IPV6, ipv6HdrIncl, 1); err != nil {
+		syscall.Close(fd)
+		return err
+	}
+
+	if err := syscall.EpollCtl(s.epfd, syscall.EPOLL_CTL_ADD, fd, &syscall.EpollEvent{
+		Events: syscall.EPOLLIN | syscall.EPOLLERR,
+		Fd:     int32(fd),
+	}); err != nil {
+		syscall.Close(fd)
+		return err
+	}
+
+	s.fd6 = fd
+	return nil
+}
+
+// openUDP creates the raw udp sockets for the address families of the
+// stack.
+func (s *Stack) openUDP() error {
+	fd, err := s.openRaw(syscall.AF_INET, syscall.IPPROTO_UDP)
+	if err != nil {
+		return fmt.Errorf("Could not create udp socket: %s", err.Error())
+	}
+
+	if s.IPv6() {
+		fd6, err := s.openRaw(syscall.AF_INET6, syscall.IPPROTO_UDP)
+		if err != nil {
+			syscall.Close(fd)
+			return fmt.Errorf("Could not create ipv6 udp socket: %s", err.Error())
+		}
+
+		s.fdUDP6 = fd6
+	}
+
+	s.fdUDP = fd
+	return nil
+}
+
+// openRaw creates a raw socket for receiving packets of the protocol. The
+// receive buffer is enlarged, as bursts of responses are expected.
+func (s *Stack) openRaw(family, proto int) (int, error) {
+	fd, err := syscall.Socket(family, syscall.SOCK_RAW, proto)
+	if err != nil {
+		return -1, err
+	}
+
+	// the buffer is capped by net.core.rmem_max, failing is harmless
+	syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_RCVBUF, udpReceiveBuffer)
+
+	if err := syscall.EpollCtl(s.epfd, syscall.EPOLL_CTL_ADD, fd, &syscall.EpollEvent{
+		Events: syscall.EPOLLIN | syscall.EPOLLERR,
+		Fd:     int32(fd),
+	}); err != nil {
+		syscall.Close(fd)
+		return -1, err
+	}
+
+	return fd, nil
+}
+
+// IPv6 returns whether ipv6 addresses can be connected to.
+func (s *Stack) IPv6() bool {
+	return s.fd6 >= 0
 }
 
 func (s *Stack) Connect(dest net.IP, port int) (*Connection, error) {
@@ -78,7 +200,17 @@ func (s *Stack) Connect(dest net.IP, port int) (*Connection, error) {
 		Dst:       dest,
 	}
 
-	if err := conn.Open(s.src, dest, port); err != nil {
+	if dest.To4() == nil {
+		if !s.IPv6() {
+			return nil, ErrNoIPv6
+		}
+
+		conn.Src = s.src6
+	} else if s.src == nil {
+		return nil, errors.New("No ipv4 address available on interface.")
+	}
+
+	if err := conn.Open(conn.Src, dest, port); err != nil {
 		return nil, err
 	}
 
@@ -95,9 +227,21 @@ func (s *Stack) Connect(dest net.IP, port int) (*Connection, error) {
 func (s *Stack) Close() {
 	syscall.Close(s.epfd)
 	syscall.Close(s.fd)
+
+	if s.fdUDP >= 0 {
+		syscall.Close(s.fdUDP)
+	}
+
+	if s.fd6 >= 0 {
+		syscall.Close(s.fd6)
+	}
+
+	if s.fdUDP6 >= 0 {
+		syscall.Close(s.fdUDP6)
+	}
 }
 
-func (s Stack) Listen() (*listener, error) {
+func (s *Stack) Listen() (*listener, error) {
 	return &listener{
 		s: make(chan bool),
 	}, nil
@@ -112,7 +256,7 @@ func (s *Stack) Start() error {
 		for {
 			nevents, err := syscall.EpollWait(s.epfd, events[:], -1)
 			if err != nil {
-				fmt.Println("epoll_wait: ", err)
+				fmt.Fprintf(os.Stderr, "epoll_wait: %s\n", err)
 				break
 			}
 
@@ -133,130 +277,176 @@ func (s *Stack) Start() error {
 }
 
 func (s *Stack) handleEventPollIn(event syscall.EpollEvent) {
+	if int(event.Fd) == s.fd6 || int(event.Fd) == s.fdUDP6 {
+		s.handleEventPollIn6(event)
+		return
+	}
+
 	if n, _, err := syscall.Recvfrom(int(event.Fd), buffer, 0); err != nil {
-		fmt.Println("Could not receive from descriptor: %s", err.Error())
+		fmt.Fprintf(os.Stderr, "Could not receive from descriptor: %s\n", err.Error())
 		return
 	} else if n == 0 {
 		// no packets received
 		return
 	} else if iph, err := ipv4.Parse(buffer); err != nil {
-		fmt.Println(fmt.Errorf("Error parsing ip header: ", err.Error()))
+		fmt.Fprintf(os.Stderr, "Error parsing ip header: %s\n", err.Error())
 	} else if iph.Len < 5 {
-		fmt.Println(fmt.Errorf("IP header length is invalid."))
+		fmt.Fprintln(os.Stderr, "IP header length is invalid.")
 	} else {
 		data := buffer[20:n]
 
 		switch iph.Protocol {
 		case 6 /* tcp */ :
-			if err := s.handleTCP(iph, data); err == ErrNoState {
+			if err := s.handleTCP(iph.Src, iph.Dst, data); err == ErrNoState {
 			} else if err != nil {
-				fmt.Printf("Error: %s\n", err.Error())
+				fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
 			}
 		case 17 /* udp */ :
-			if err := s.handleUDP(iph, data); err != nil {
-				fmt.Printf("Error: %s\n", err.Error())
+			if err := s.handleUDP(iph.Src, iph.Dst, data); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
 			}
 		default:
-			fmt.Printf("Unknown protocol: %d\n", iph.Protocol)
+			fmt.Fprintf(os.Stderr, "Unknown protocol: %d\n", iph.Protocol)
+		}
+	}
+}
+
+// handleEventPollIn6 handles packets of the ipv6 sockets. Raw ipv6 sockets
+// don't receive the ip header, the source is taken from the socket address
+// and the destination is our own address.
+func (s *Stack) handleEventPollIn6(event syscall.EpollEvent) {
+	if n, from, err := syscall.Recvfrom(int(event.Fd), buffer, 0); err != nil {
+		fmt.Fprintf(os.Stderr, "Could not receive from descriptor: %s\n", err.Error())
+	} else if n == 0 {
+	} else if sa, ok := from.(*syscall.SockaddrInet6); !ok {
+	} else if src := net.IP(append([]byte{}, sa.Addr[:]...)); int(event.Fd) == s.fdUDP6 {
+		if err := s.handleUDP(src, s.src6, buffer[:n]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
 		}
+	} else if err := s.handleTCP(src, s.src6, buffer[:n]); err == ErrNoState {
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
 	}
 }
 
 func (s *Stack) handleEventPollErr(event syscall.EpollEvent) {
 	if v, err := syscall.GetsockoptInt(int(event.Fd), syscall.SOL_SOCKET, syscall.SO_ERROR); err != nil {
-		fmt.Println("Error", err)
+		fmt.Fprintln(os.Stderr, "Error", err)
 	} else {
-		fmt.Println("Error val", v)
+		fmt.Fprintln(os.Stderr, "Error val", v)
 	}
 }
 
+// send updates the checksums of the ip packet in data and sends it using the
+// socket of its address family.
 func (s *Stack) send(data []byte) error {
-	// update ip checksum
-	csum := uint32(0)
-
-	// calculate correct ip header length here, with opts
-	length := 20 // len(data1) - 1
-	for i := 0; i < length; i += 2 {
-		if i == 10 {
-			continue
-		}
-
-		csum += uint32(data[i]) << 8
-		csum += uint32(data[i+1])
-	}
+	var (
+		fd       int
+		to       syscall.Sockaddr
+		src, dst net.IP
+		proto    int
+		payload  []byte
+	)
 
-	for {
-		// Break when sum is less or equals to 0xFFFF
-		if csum <= 65535 {
-			break
+	switch data[0] >> 4 {
+	case 4:
+		length := int(data[0]&0x0f) << 2
+
+		// update ip checksum
+		data[10], data[11] = 0, 0
+
+		csum := fold(sum(0, data[:length]))
+		data[10] = uint8(csum >> 8)
+		data[11] = uint8(csum)
+
+		fd = s.fd
+		to = &syscall.SockaddrInet4{Port: int(0), Addr: [4]byte{data[16], data[17], data[18], data[19]}}
+		src, dst = net.IP(data[12:16]), net.IP(data[16:20])
+		proto = int(data[9])
+		payload = data[length:]
+	case 6:
+		if s.fd6 < 0 {
+			return ErrNoIPv6
 		}
-		// Add carry to the sum
-		csum = (csum >> 16) + uint32(uint16(csum))
-	}
 
-	csum = uint32(^uint16(csum))
+		sa := &syscall.SockaddrInet6{}
+		copy(sa.Addr[:], data[24:40])
 
-	data[10] = uint8((csum >> 8) & 0xFF)
-	data[11] = uint8(csum & 0xFF)
+		fd = s.fd6
+		to = sa
+		src, dst = net.IP(data[8:24]), net.IP(data[24:40])
+		proto = int(data[6])
+		payload = data[40:]
+	default:
+		return fmt.Errorf("Unknown ip version: %d", data[0]>>4)
+	}
 
-	// update tcp checksum
-	length = len(data) - 20
+	// update tcp or udp checksum
+	transportChecksum(src, dst, proto, payload)
 
-	csum = uint32(0)
+	if err := syscall.Sendto(fd, data, 0, to); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s %d\n", err.Error(), len(data))
+		return err
+	}
 
-	csum += (uint32(data[12]) + uint32(data[14])) << 8
-	csum += uint32(data[13]) + uint32(data[15])
-	csum += (uint32(data[16]) + uint32(data[18])) << 8
-	csum += uint32(data[17]) + uint32(data[19])
+	return nil
+}
 
-	csum += uint32(6)
-	csum += uint32(length) & 0xffff
-	csum += uint32(length) >> 16
+// sendTCP wraps the tcp segment in an ip header for the address family of
+// dst and sends it.
+func (s *Stack) sendTCP(src, dst net.IP, id int, th *tcp.Header) error {
+	payload, err := th.Marshal()
+	if err != nil {
+		return err
+	}
 
-	length = len(data) - 1
+	return s.sendIP(src, dst, id, 6 /* tcp */, payload)
+}
 
-	// calculate correct ip header length here.
-	for i := 20; i < length; i += 2 {
-		if i == 20+16 {
-			continue
-		}
+// sendIP wraps the payload of the protocol in an ip header for the address
+// family of dst and sends it.
+func (s *Stack) sendIP(src, dst net.IP, id int, proto int, payload []byte) error {
+	var (
+		data []byte
+		err  error
+	)
 
-		csum += uint32(data[i]) << 8
-		csum += uint32(data[i+1])
-	}
+	if dst.To4() != nil {
+		iph := ipv4.New().
+			WithSource(src).
+			WithDestination(dst).
+			WithID(id)
 
-	if len(data)%2 == 1 {
-		csum += uint32(data[length]) << 8
-	}
+		iph.Protocol = proto
+		iph.Payload = payload
+		data, err = iph.Marshal()
+	} else {
+		iph := ipv6.New().
+			WithSource(src).
+			WithDestination(dst)
 
-	for csum > 0xffff {
-		csum = (csum >> 16) + (csum & 0xffff)
+		iph.NextHeader = proto
+		iph.Payload = payload
+		data, err = iph.Marshal()
 	}
 
-	csum = uint32(^uint16(csum + (csum >> 16)))
-
-	data[20+16] = uint8((csum >> 8) & 0xFF)
-	data[20+17] = uint8(csum & 0xFF)
-
-	to := &syscall.SockaddrInet4{Port: int(0), Addr: [4]byte{data[16], data[17], data[18], data[19]}} //[4]byte{dest[0], dest[1], dest[2], dest[
-	if err := syscall.Sendto((int(s.fd)), data, 0, to); err != nil {
-		fmt.Println(fmt.Sprintf("Error: %s %d\n", err.Error(), len(data)))
+	if err != nil {
 		return err
 	}
 
-	return nil
+	return s.send(data)
 }
 
-func (s *Stack) handleTCP(iph *ipv4.Header, data []byte) error {
+func (s *Stack) handleTCP(src, dst net.IP, data []byte) error {
 	var th *tcp.Header
 	if v, err := tcp.Parse(data); err != nil {
-		fmt.Printf("err th: %s\n", err)
+		fmt.Fprintf(os.Stderr, "err th: %s\n", err)
 		return err
 	} else {
 		th = &v
 	}
 
-	state := stateTable.Get(iph.Src, iph.Dst, th.Source, th.Destination)
+	state := stateTable.Get(src, dst, th.Source, th.Destination)
 	if state != nil {
 	} else if th.HasFlag(tcp.SYN) {
 		// listening on port
@@ -302,25 +492,11 @@ func (s *Stack) handleTCP(iph *ipv4.Header, data []byte) error {
 
 	if state.SocketState == SocketSynSent {
 		if !th.HasFlag(tcp.SYN | tcp.ACK) {
-			fmt.Printf("StateSynSent: unexpected ctrl %d\n", th.Ctrl)
+			fmt.Fprintf(os.Stderr, "StateSynSent: unexpected ctrl %d\n", th.Ctrl)
 			state.SocketState = SocketClosed
 			return nil
 		}
 
-		iph := ipv4.Header{
-			Version:  4,
-			Len:      20,
-			TOS:      0,
-			TotalLen: 52,
-			Flags:    2,
-			TTL:      128,
-			Protocol: 6,
-			Src:      iph.Dst,
-			Dst:      iph.Src,
-			Options:  []byte{},
-			ID:       state.ID,
-		}
-
 		th := tcp.Header{
 			Source:      th.Destination,
 			Destination: th.Source,
@@ -337,15 +513,7 @@ func (s *Stack) handleTCP(iph *ipv4.Header, data []byte) error {
 			Payload:     []byte{},
 		}
 
-		if data, err := th.Marshal(); err == nil {
-			iph.Payload = data
-		} else {
-			return err
-		}
-
-		if data, err := iph.Marshal(); err == nil {
-			s.send(data)
-		} else {
+		if err := s.sendTCP(dst, src, state.ID, &th); err != nil {
 			return err
 		}
 
@@ -361,11 +529,6 @@ func (s *Stack) handleTCP(iph *ipv4.Header, data []byte) error {
 	} else if state.SocketState == SocketEstablished {
 		if th.Ctrl == tcp.ACK {
 		} else {
-			iph := ipv4.New().
-				WithSource(iph.Dst).
-				WithDestination(iph.Src).
-				WithID(state.ID)
-
 			th := tcp.Header{
 				Source:      th.Destination,
 				Destination: th.Source,
@@ -382,15 +545,7 @@ func (s *Stack) handleTCP(iph *ipv4.Header, data []byte) error {
 				Payload:     []byte{},
 			}
 
-			if data, err := th.Marshal(); err == nil {
-				iph.Payload = data
-			} else {
-				return err
-			}
-
-			if data, err := iph.Marshal(); err == nil {
-				s.send(data)
-			} else {
+			if err := s.sendTCP(dst, src, state.ID, &th); err != nil {
 				return err
 			}
 
@@ -409,20 +564,6 @@ func (s *Stack) handleTCP(iph *ipv4.Header, data []byte) error {
 		}
 
 		if th.HasFlag(tcp.FIN) {
-			iph := ipv4.Header{
-				Version:  4,
-				Len:      20,
-				TOS:      0,
-				TotalLen: 52,
-				Flags:    2,
-				TTL:      128,
-				Protocol: 6,
-				Src:      iph.Dst,
-				Dst:      iph.Src,
-				Options:  []byte{},
-				ID:       state.ID,
-			}
-
 			th := tcp.Header{
 				Source:      th.Destination,
 				Destination: th.Source,
@@ -439,15 +580,7 @@ func (s *Stack) handleTCP(iph *ipv4.Header, data []byte) error {
 				Payload:     []byte{},
 			}
 
-			if data, err := th.Marshal(); err == nil {
-				iph.Payload = data
-			} else {
-				return err
-			}
-
-			if data, err := iph.Marshal(); err == nil {
-				s.send(data)
-			} else {
+			if err := s.sendTCP(dst, src, state.ID, &th); err != nil {
 				return err
 			}
 
@@ -460,20 +593,6 @@ func (s *Stack) handleTCP(iph *ipv4.Header, data []byte) error {
 		}
 	} else if state.SocketState == SocketFinWait1 {
 		if th.HasFlag(tcp.FIN) {
-			iph := ipv4.Header{
-				Version:  4,
-				Len:      20,
-				TOS:      0,
-				TotalLen: 52,
-				Flags:    2,
-				TTL:      128,
-				Protocol: 6,
-				Src:      iph.Dst,
-				Dst:      iph.Src,
-				Options:  []byte{},
-				ID:       state.ID,
-			}
-
 			th := tcp.Header{
 				Source:      th.Destination,
 				Destination: th.Source,
@@ -490,15 +609,7 @@ func (s *Stack) handleTCP(iph *ipv4.Header, data []byte) error {
 				Payload:     []byte{},
 			}
 
-			if data, err := th.Marshal(); err == nil {
-				iph.Payload = data
-			} else {
-				return err
-			}
-
-			if data, err := iph.Marshal(); err == nil {
-				s.send(data)
-			} else {
+			if err := s.sendTCP(dst, src, state.ID, &th); err != nil {
 				return err
 			}
 
@@ -509,20 +620,6 @@ func (s *Stack) handleTCP(iph *ipv4.Header, data []byte) error {
 			state.SocketState = SocketFinWait2
 		}
 	} else if state.SocketState == SocketFinWait2 {
-		iph := ipv4.Header{
-			Version:  4,
-			Len:      20,
-			TOS:      0,
-			TotalLen: 52,
-			Flags:    2,
-			TTL:      128,
-			Protocol: 6,
-			Src:      iph.Dst,
-			Dst:      iph.Src,
-			Options:  []byte{},
-			ID:       state.ID,
-		}
-
 		th := tcp.Header{
 			Source:      th.Destination,
 			Destination: th.Source,
@@ -539,15 +636,7 @@ func (s *Stack) handleTCP(iph *ipv4.Header, data []byte) error {
 			Payload:     []byte{},
 		}
 
-		if data, err := th.Marshal(); err == nil {
-			iph.Payload = data
-		} else {
-			return err
-		}
-
-		if data, err := iph.Marshal(); err == nil {
-			s.send(data)
-		} else {
+		if err := s.sendTCP(dst, src, state.ID, &th); err != nil {
 			return err
 		}
 
@@ -573,62 +662,8 @@ func (s *Stack) handleTCP(iph *ipv4.Header, data []byte) error {
 		// timeout
 		// then socketstate -> socketclosed
 	} else if state.SocketState == SocketClosed {
-		fmt.Println("Got packets on closed socket.")
+		fmt.Fprintln(os.Stderr, "Got packets on closed socket.")
 	}
 
 	return nil
 }
-
-func (s *Stack) handleUDP(iph *ipv4.Header, data []byte) error {
-	return nil
-	/*
-		hdr := &udp.Header{} // tcp.Header
-		hdr.Unmarshal(data)
-
-		// remove checksum, should be recalculated
-		hdr.Checksum = 0
-
-		// currently only interested in
-		if hdr.Source != 53 && hdr.Destination != 53 {
-			fmt.Println("Ignoring port")
-			return
-		}
-
-		if iph.Src.Equal(net.ParseIP("8.8.8.8")) {
-			iph.Src = iph.Dst
-			iph.Dst = net.ParseIP("172.16.84.1")
-		} else if iph.Src.Equal(net.ParseIP("172.16.84.1")) {
-			iph.Src = iph.Dst
-			iph.Dst = net.ParseIP("8.8.8.8")
-		} else {
-			fmt.Println("Unknown traffic", iph.Src.String(), net.ParseIP("172.168.84.1").String())
-			return
-		}
-
-		// do we have active sockets?
-		// send to socket
-		// check source address, port with destination address, port
-
-		client := UDPConn{
-			closed:      false,
-			readBuffer:  hdr.Payload,
-			writeBuffer: []byte{},
-			iph:         iph,
-			hdr:         hdr,
-			s:           s,
-		}
-
-		server := UDPConn{
-			closed:      false,
-			readBuffer:  []byte{},
-			writeBuffer: []byte{},
-			iph:         iph,
-			hdr:         hdr,
-			s:           s,
-		}
-
-		if err := Proxy(&client, &server); err != nil {
-			log.Printf("Error proxy: %#v\n", err.Error())
-		}
-	*/
-}
@@ -1,7 +1,7 @@
-package netstack
-
 // +build amd64,linux
 
+package netstack
+
 import (
 	"net"
 	_ "net/http/pprof"
@@ -0,0 +1,97 @@
+package netstack
+
+import (
+	"errors"
+	"math/rand"
+	"net"
+
+	udp "github.com/dutchcoders/anam/netstack/udp"
+)
+
+// UDPPacket is an udp datagram sent or received by the stack.
+type UDPPacket struct {
+	Src, Dst                    net.IP
+	SourcePort, DestinationPort uint16
+
+	Payload []byte
+}
+
+// UDPHandler is called for every received udp packet. Packets for all ports
+// are passed, the handler needs to filter the ones it is interested in.
+type UDPHandler func(p *UDPPacket)
+
+// HandleUDP registers the handler for received udp packets, before the stack
+// is started. The raw udp sockets receive every udp packet of the host, they
+// are only opened for the first handler. Handlers are called from the
+// receive loop and shouldn't block.
+func (s *Stack) HandleUDP(h UDPHandler) error {
+	s.udpm.Lock()
+	defer s.udpm.Unlock()
+
+	if s.fdUDP >= 0 {
+	} else if err := s.openUDP(); err != nil {
+		return err
+	}
+
+	s.udpHandlers = append(s.udpHandlers, h)
+	return nil
+}
+
+// SendUDP sends the payload to dst from the source port. The source address
+// is the address of the interface for the address family of dst. There is no
+// socket bound to the port, the kernel will respond to replies with icmp port
+// unreachable messages unless these are filtered.
+func (s *Stack) SendUDP(dst net.IP, sport, dport uint16, payload []byte) error {
+	src := s.src
+	if dst.To4() == nil {
+		if !s.IPv6() {
+			return ErrNoIPv6
+		}
+
+		src = s.src6
+	} else if src == nil {
+		return errors.New("No ipv4 address available on interface.")
+	}
+
+	hdr := udp.Header{
+		Source:      sport,
+		Destination: dport,
+		Payload:     payload,
+	}
+
+	data, err := hdr.Marshal()
+	if err != nil {
+		return err
+	}
+
+	return s.sendIP(src, dst, rand.Intn(0xffff), 17 /* udp */, data)
+}
+
+func (s *Stack) handleUDP(src, dst net.IP, data []byte) error {
+	s.udpm.RLock()
+	defer s.udpm.RUnlock()
+
+	if len(s.udpHandlers) == 0 {
+		return nil
+	}
+
+	hdr, err := udp.Parse(data)
+	if err != nil {
+		return err
+	}
+
+	// the receive buffer is reused
+	p := &UDPPacket{
+		Src:             append(net.IP{}, src...),
+		Dst:             append(net.IP{}, dst...),
+		SourcePort:      hdr.Source,
+		DestinationPort: hdr.Destination,
+		Payload:         append([]byte{}, hdr.Payload...),
+	}
+
+	for _, h := range s.udpHandlers {
+		h(p)
+	}
+
+	return nil
+}
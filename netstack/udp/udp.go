@@ -0,0 +1,73 @@
+package udp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// HeaderLen is the length of the udp header
+const HeaderLen = 8
+
+var errHeaderTooShort = errors.New("header too short")
+
+// A Header represents an UDP header, followed by the payload.
+type Header struct {
+	Source      uint16
+	Destination uint16
+	Length      uint16
+	Checksum    uint16 // set by the stack when sending
+
+	Payload []byte
+}
+
+func (h *Header) String() string {
+	if h == nil {
+		return "<nil>"
+	}
+
+	return fmt.Sprintf("src=%d dst=%d len=%d cksum=%#x", h.Source, h.Destination, h.Length, h.Checksum)
+}
+
+// Marshal returns the binary encoding of the header, followed by the
+// payload.
+func (h *Header) Marshal() ([]byte, error) {
+	h.Length = uint16(HeaderLen + len(h.Payload))
+
+	b := make([]byte, HeaderLen+len(h.Payload))
+	binary.BigEndian.PutUint16(b[0:2], h.Source)
+	binary.BigEndian.PutUint16(b[2:4], h.Destination)
+	binary.BigEndian.PutUint16(b[4:6], h.Length)
+	binary.BigEndian.PutUint16(b[6:8], h.Checksum)
+
+	copy(b[HeaderLen:], h.Payload)
+
+	return b, nil
+}
+
+// Parse parses b as an UDP header.
+func Parse(b []byte) (*Header, error) {
+	h := &Header{}
+	return h, h.Unmarshal(b)
+}
+
+// Unmarshal decodes the header of b, the payload refers to b.
+func (h *Header) Unmarshal(b []byte) error {
+	if len(b) < HeaderLen {
+		return errHeaderTooShort
+	}
+
+	h.Source = binary.BigEndian.Uint16(b[0:2])
+	h.Destination = binary.BigEndian.Uint16(b[2:4])
+	h.Length = binary.BigEndian.Uint16(b[4:6])
+	h.Checksum = binary.BigEndian.Uint16(b[6:8])
+
+	end := int(h.Length)
+	if end < HeaderLen || end > len(b) {
+		end = len(b)
+	}
+
+	h.Payload = b[HeaderLen:end]
+
+	return nil
+}
@@ -0,0 +1,149 @@
+package output
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dutchcoders/anam/scanner"
+)
+
+var csvHeader = []string{
+	"time",
+	"host",
+	"ip",
+	"port",
+	"tls",
+	"probe",
+	"severity",
+	"method",
+	"path",
+	"status",
+	"body_length",
+	"body_hash",
+	"duration_ns",
+	"error_class",
+	"error",
+	"headers",
+	"extracted",
+	"findings",
+	"secrets",
+	"cnames",
+	"wildcard",
+}
+
+// CSVWriter writes results as comma separated values, starting with a
+// header row unless appending to earlier results. Response headers, extracted values, findings, secrets and
+// cnames are stored as JSON.
+type CSVWriter struct {
+	m sync.Mutex
+
+	w   io.WriteCloser
+	csv *csv.Writer
+}
+
+func NewCSVWriter(w io.WriteCloser, header bool) (*CSVWriter, error) {
+	cw := &CSVWriter{
+		w:   w,
+		csv: csv.NewWriter(w),
+	}
+
+	if !header {
+	} else if err := cw.csv.Write(csvHeader); err != nil {
+		return nil, err
+	}
+
+	return cw, nil
+}
+
+func (w *CSVWriter) Write(r *scanner.Result) error {
+	headers, err := marshal(r.Header)
+	if err != nil {
+		return err
+	}
+
+	extracted, err := marshal(r.Extracted)
+	if err != nil {
+		return err
+	}
+
+	findings, err := marshal(r.Findings)
+	if err != nil {
+		return err
+	}
+
+	secrets, err := marshal(r.Secrets)
+	if err != nil {
+		return err
+	}
+
+	cnames, err := marshal(r.CNAMEs)
+	if err != nil {
+		return err
+	}
+
+	ip := ""
+	if r.IP != nil {
+		ip = r.IP.String()
+	}
+
+	status := ""
+	if r.Status != 0 {
+		status = strconv.Itoa(r.Status)
+	}
+
+	record := []string{
+		r.Time.UTC().Format(time.RFC3339Nano),
+		r.Host,
+		ip,
+		strconv.Itoa(r.Port),
+		strconv.FormatBool(r.TLS),
+		r.Probe,
+		r.Severity,
+		r.Method,
+		r.Path,
+		status,
+		strconv.Itoa(r.BodyLength),
+		r.BodyHash,
+		strconv.FormatInt(int64(r.Duration), 10),
+		string(r.ErrorClass),
+		r.Error,
+		headers,
+		extracted,
+		findings,
+		secrets,
+		cnames,
+		strconv.FormatBool(r.Wildcard),
+	}
+
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	return w.csv.Write(record)
+}
+
+func (w *CSVWriter) Flush() error {
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	w.csv.Flush()
+	if err := w.csv.Error(); err != nil {
+		return err
+	}
+
+	return syncFile(w.w)
+}
+
+func (w *CSVWriter) Close() error {
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	w.csv.Flush()
+	if err := w.csv.Error(); err != nil {
+		return err
+	}
+
+	return w.w.Close()
+}
@@ -0,0 +1,95 @@
+package output
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"sync"
+
+	"github.com/dutchcoders/anam/scanner"
+)
+
+// JSONWriter writes every result as a single JSON object per line.
+type JSONWriter struct {
+	m sync.Mutex
+
+	buf *bufio.Writer
+	enc *json.Encoder
+
+	// flushers are flushed after buf, closers are closed in order
+	flushers []flusher
+	closers  []io.Closer
+}
+
+type flusher interface {
+	Flush() error
+}
+
+func NewJSONWriter(w io.WriteCloser) *JSONWriter {
+	buf := bufio.NewWriter(w)
+
+	return &JSONWriter{
+		buf:     buf,
+		enc:     json.NewEncoder(buf),
+		closers: []io.Closer{w},
+	}
+}
+
+// NewGzipWriter returns a JSONWriter that gzip compresses its output.
+func NewGzipWriter(w io.WriteCloser) *JSONWriter {
+	zw := gzip.NewWriter(w)
+	buf := bufio.NewWriter(zw)
+
+	return &JSONWriter{
+		buf:      buf,
+		enc:      json.NewEncoder(buf),
+		flushers: []flusher{zw},
+		closers:  []io.Closer{zw, w},
+	}
+}
+
+func (w *JSONWriter) Write(r *scanner.Result) error {
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	return w.enc.Encode(r)
+}
+
+func (w *JSONWriter) Flush() error {
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	return w.flush()
+}
+
+func (w *JSONWriter) flush() error {
+	if err := w.buf.Flush(); err != nil {
+		return err
+	}
+
+	for _, f := range w.flushers {
+		if err := f.Flush(); err != nil {
+			return err
+		}
+	}
+
+	return syncFile(w.closers[len(w.closers)-1])
+}
+
+func (w *JSONWriter) Close() error {
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	if err := w.buf.Flush(); err != nil {
+		return err
+	}
+
+	for _, c := range w.closers {
+		if err := c.Close(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,125 @@
+// Package output contains the result writers that can be selected using
+// the --format and --output flags.
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/dutchcoders/anam/config"
+	"github.com/dutchcoders/anam/scanner"
+)
+
+const (
+	FormatConsole    = "console"
+	FormatJSONLines  = "jsonl"
+	FormatCSV        = "csv"
+	FormatNDJSONGzip = "ndjson-gzip"
+	FormatSQLite     = "sqlite"
+)
+
+// New returns the ResultWriter for the configured format, writing to the
+// configured output. An empty output or "-" writes to stdout. When no
+// format is set it is derived from the extension of the output.
+func New(cfg *config.Config) (scanner.ResultWriter, error) {
+	format, path := cfg.Format, cfg.Output
+	if format == "" {
+		format = detect(path)
+	}
+
+	switch format {
+	case FormatConsole:
+		return scanner.NewConsoleWriter(), nil
+	case FormatSQLite:
+		return NewSQLiteWriter(path, cfg)
+	}
+
+	// a resumed scan appends to the results written before
+	w, appended, err := create(path, cfg.Resume)
+	if err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case FormatJSONLines:
+		return NewJSONWriter(w), nil
+	case FormatCSV:
+		return NewCSVWriter(w, !appended)
+	case FormatNDJSONGzip:
+		return NewGzipWriter(w), nil
+	default:
+		w.Close()
+		return nil, fmt.Errorf("Unknown output format: %s", format)
+	}
+}
+
+func detect(path string) string {
+	switch {
+	case path == "" || path == "-":
+		return FormatConsole
+	case strings.HasSuffix(path, ".csv"):
+		return FormatCSV
+	case strings.HasSuffix(path, ".gz"):
+		return FormatNDJSONGzip
+	case strings.HasSuffix(path, ".db"), strings.HasSuffix(path, ".sqlite"), strings.HasSuffix(path, ".sqlite3"):
+		return FormatSQLite
+	default:
+		return FormatJSONLines
+	}
+}
+
+// marshal returns v encoded as JSON, or an empty string when the map or
+// slice v is empty.
+func marshal(v interface{}) (string, error) {
+	if reflect.ValueOf(v).Len() == 0 {
+		return "", nil
+	}
+
+	data, err := json.Marshal(v)
+	return string(data), err
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+// create opens the output, appending to it when resuming. It returns
+// whether the output already contained data.
+func create(path string, resume bool) (io.WriteCloser, bool, error) {
+	if path == "" || path == "-" {
+		return nopCloser{os.Stdout}, false, nil
+	} else if !resume {
+		f, err := os.Create(path)
+		return f, false, err
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, false, err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, false, err
+	}
+
+	return f, fi.Size() > 0, nil
+}
+
+// syncFile commits the written data to disk when w is a file.
+func syncFile(w interface{}) error {
+	if f, ok := w.(*os.File); ok {
+		return f.Sync()
+	}
+
+	return nil
+}
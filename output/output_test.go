@@ -0,0 +1,97 @@
+package output
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dutchcoders/anam/config"
+	"github.com/dutchcoders/anam/scanner"
+)
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "output")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return dir
+}
+
+func writeResult(t *testing.T, cfg *config.Config, host string) {
+	w, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.Write(&scanner.Result{Host: host}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestResumeAppends(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"results.jsonl", "results.csv"} {
+		cfg := &config.Config{
+			Output: filepath.Join(dir, name),
+		}
+
+		writeResult(t, cfg, "a.example.com")
+
+		cfg.Resume = true
+		writeResult(t, cfg, "b.example.com")
+
+		data, err := ioutil.ReadFile(cfg.Output)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, host := range []string{"a.example.com", "b.example.com"} {
+			if !strings.Contains(string(data), host) {
+				t.Errorf("%s lacks %s:\n%s", name, host, data)
+			}
+		}
+
+		if n := strings.Count(string(data), "body_hash"); strings.HasSuffix(name, ".csv") && n != 1 {
+			t.Errorf("%s has %d header rows:\n%s", name, n, data)
+		}
+	}
+}
+
+func TestFlush(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"results.jsonl", "results.csv", "results.gz"} {
+		path := filepath.Join(dir, name)
+
+		w, err := New(&config.Config{Output: path})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := w.Write(&scanner.Result{Host: "example.com"}); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := w.Flush(); err != nil {
+			t.Fatal(err)
+		}
+
+		if fi, err := os.Stat(path); err != nil {
+			t.Fatal(err)
+		} else if fi.Size() == 0 {
+			t.Errorf("%s is empty after flush", name)
+		}
+
+		w.Close()
+	}
+}
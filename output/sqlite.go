@@ -0,0 +1,320 @@
+package output
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/dutchcoders/anam/config"
+	"github.com/dutchcoders/anam/scanner"
+)
+
+// number of results written per transaction
+const sqliteBatchSize = 500
+
+// sqliteMigrations contains the schema changes per version, the current
+// version of a database is kept in its user_version.
+var sqliteMigrations = [][]string{{
+	`CREATE TABLE IF NOT EXISTS runs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		started_at TIMESTAMP NOT NULL,
+		finished_at TIMESTAMP,
+		config TEXT,
+		results INTEGER NOT NULL DEFAULT 0,
+		errors INTEGER NOT NULL DEFAULT 0
+	)`,
+	`CREATE TABLE IF NOT EXISTS hosts (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL UNIQUE
+	)`,
+	`CREATE TABLE IF NOT EXISTS ips (
+		run_id INTEGER NOT NULL REFERENCES runs(id),
+		host_id INTEGER NOT NULL REFERENCES hosts(id),
+		ip TEXT NOT NULL,
+		UNIQUE (run_id, host_id, ip)
+	)`,
+	`CREATE TABLE IF NOT EXISTS responses (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		run_id INTEGER NOT NULL REFERENCES runs(id),
+		host_id INTEGER NOT NULL REFERENCES hosts(id),
+		ip TEXT,
+		port INTEGER,
+		tls BOOLEAN,
+		path TEXT,
+		status INTEGER,
+		headers TEXT,
+		body_length INTEGER,
+		body_hash TEXT,
+		time TIMESTAMP,
+		duration_ns INTEGER,
+		error_class TEXT,
+		error TEXT
+	)`,
+	`CREATE INDEX IF NOT EXISTS responses_path ON responses (path, status)`,
+	`CREATE INDEX IF NOT EXISTS responses_host ON responses (host_id)`,
+}, {
+	`ALTER TABLE responses ADD COLUMN probe TEXT`,
+	`ALTER TABLE responses ADD COLUMN severity TEXT`,
+	`ALTER TABLE responses ADD COLUMN method TEXT`,
+	`ALTER TABLE responses ADD COLUMN extracted TEXT`,
+}, {
+	`ALTER TABLE responses ADD COLUMN findings TEXT`,
+}, {
+	`ALTER TABLE responses ADD COLUMN secrets TEXT`,
+}, {
+	`ALTER TABLE responses ADD COLUMN cnames TEXT`,
+}, {
+	`ALTER TABLE responses ADD COLUMN wildcard BOOLEAN`,
+}}
+
+// SQLiteWriter stores results in a SQLite database. Every scan is recorded
+// as a run, together with a snapshot of its configuration.
+type SQLiteWriter struct {
+	m sync.Mutex
+
+	db    *sql.DB
+	tx    *sql.Tx
+	runID int64
+
+	// results and errors of the open transaction
+	pending       int
+	pendingErrors int
+
+	results int
+	errors  int
+}
+
+func NewSQLiteWriter(path string, cfg *config.Config) (*SQLiteWriter, error) {
+	if path == "" || path == "-" {
+		return nil, errors.New("The sqlite format requires an output file.")
+	}
+
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, err
+	}
+
+	db.SetMaxOpenConns(1)
+
+	if err := migrate(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	snapshot, err := json.Marshal(cfg)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	w := &SQLiteWriter{
+		db: db,
+	}
+
+	if res, err := db.Exec("INSERT INTO runs (started_at, config) VALUES (?, ?)", time.Now().UTC(), string(snapshot)); err != nil {
+		db.Close()
+		return nil, err
+	} else if id, err := res.LastInsertId(); err != nil {
+		db.Close()
+		return nil, err
+	} else {
+		w.runID = id
+	}
+
+	return w, nil
+}
+
+func migrate(db *sql.DB) error {
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+
+	for ; version < len(sqliteMigrations); version++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+
+		for _, stmt := range sqliteMigrations[version] {
+			if _, err := tx.Exec(stmt); err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", version+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Write inserts the result in the open transaction, which is committed
+// every sqliteBatchSize results and on Flush. A failed result is rolled back
+// to the savepoint before it, keeping the results written before it. When
+// that fails the transaction is rolled back, and the next result starts a
+// new one.
+func (w *SQLiteWriter) Write(r *scanner.Result) error {
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	if w.tx == nil {
+		if tx, err := w.db.Begin(); err != nil {
+			return err
+		} else {
+			w.tx = tx
+		}
+	}
+
+	if _, err := w.tx.Exec("SAVEPOINT result"); err != nil {
+		w.rollback()
+		return err
+	}
+
+	if err := w.insert(r); err != nil {
+		if _, err := w.tx.Exec("ROLLBACK TO result"); err != nil {
+			w.rollback()
+		} else if _, err := w.tx.Exec("RELEASE result"); err != nil {
+			w.rollback()
+		}
+
+		return err
+	}
+
+	if _, err := w.tx.Exec("RELEASE result"); err != nil {
+		w.rollback()
+		return err
+	}
+
+	if r.ErrorClass != scanner.ErrorNone {
+		w.pendingErrors++
+	}
+
+	w.pending++
+	if w.pending < sqliteBatchSize {
+		return nil
+	}
+
+	return w.commit()
+}
+
+func (w *SQLiteWriter) insert(r *scanner.Result) error {
+	if _, err := w.tx.Exec("INSERT OR IGNORE INTO hosts (name) VALUES (?)", r.Host); err != nil {
+		return err
+	}
+
+	var hostID int64
+	if err := w.tx.QueryRow("SELECT id FROM hosts WHERE name = ?", r.Host).Scan(&hostID); err != nil {
+		return err
+	}
+
+	ip := ""
+	if r.IP != nil {
+		ip = r.IP.String()
+
+		if _, err := w.tx.Exec("INSERT OR IGNORE INTO ips (run_id, host_id, ip) VALUES (?, ?, ?)", w.runID, hostID, ip); err != nil {
+			return err
+		}
+	}
+
+	headers, err := marshal(r.Header)
+	if err != nil {
+		return err
+	}
+
+	extracted, err := marshal(r.Extracted)
+	if err != nil {
+		return err
+	}
+
+	findings, err := marshal(r.Findings)
+	if err != nil {
+		return err
+	}
+
+	secrets, err := marshal(r.Secrets)
+	if err != nil {
+		return err
+	}
+
+	cnames, err := marshal(r.CNAMEs)
+	if err != nil {
+		return err
+	}
+
+	if _, err := w.tx.Exec(`INSERT INTO responses
+		(run_id, host_id, ip, port, tls, probe, severity, method, path, status, headers, body_length, body_hash, extracted, findings, secrets, cnames, wildcard, time, duration_ns, error_class, error)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		w.runID, hostID, ip, r.Port, r.TLS, r.Probe, r.Severity, r.Method, r.Path, r.Status, headers, r.BodyLength, r.BodyHash, extracted, findings, secrets, cnames, r.Wildcard, r.Time.UTC(), int64(r.Duration), string(r.ErrorClass), r.Error,
+	); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (w *SQLiteWriter) commit() error {
+	if w.tx == nil {
+		return nil
+	}
+
+	tx := w.tx
+	pending, pendingErrors := w.pending, w.pendingErrors
+
+	w.tx = nil
+	w.pending, w.pendingErrors = 0, 0
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	w.results += pending
+	w.errors += pendingErrors
+	return nil
+}
+
+// rollback discards the open transaction.
+func (w *SQLiteWriter) rollback() {
+	if w.tx == nil {
+		return
+	}
+
+	w.tx.Rollback()
+
+	w.tx = nil
+	w.pending, w.pendingErrors = 0, 0
+}
+
+// Flush commits the open transaction.
+func (w *SQLiteWriter) Flush() error {
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	return w.commit()
+}
+
+func (w *SQLiteWriter) Close() error {
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	defer w.db.Close()
+
+	if err := w.commit(); err != nil {
+		return err
+	}
+
+	_, err := w.db.Exec("UPDATE runs SET finished_at = ?, results = ?, errors = ? WHERE id = ?", time.Now().UTC(), w.results, w.errors, w.runID)
+	return err
+}
@@ -0,0 +1,72 @@
+package output
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dutchcoders/anam/config"
+	"github.com/dutchcoders/anam/scanner"
+)
+
+func TestSQLiteWriteError(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	w, err := NewSQLiteWriter(filepath.Join(dir, "results.db"), &config.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer w.Close()
+
+	if err := w.Write(&scanner.Result{Host: "a.example.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// make the next insert fail within the open transaction
+	if _, err := w.tx.Exec("ALTER TABLE responses RENAME TO responses_old"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.Write(&scanner.Result{Host: "b.example.com"}); err == nil {
+		t.Fatal("write should fail")
+	}
+
+	if _, err := w.tx.Exec("ALTER TABLE responses_old RENAME TO responses"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.Write(&scanner.Result{Host: "c.example.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := w.db.Query("SELECT h.name FROM responses r JOIN hosts h ON h.id = r.host_id ORDER BY h.name")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer rows.Close()
+
+	hosts := []string{}
+	for rows.Next() {
+		var host string
+		if err := rows.Scan(&host); err != nil {
+			t.Fatal(err)
+		}
+
+		hosts = append(hosts, host)
+	}
+
+	if len(hosts) != 2 || hosts[0] != "a.example.com" || hosts[1] != "c.example.com" {
+		t.Errorf("stored %v, should store the results before and after the failed one", hosts)
+	}
+
+	if w.results != 2 {
+		t.Errorf("results is %d, should be 2", w.results)
+	}
+}
@@ -0,0 +1,54 @@
+package probe
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Load reads all yaml templates (*.yml, *.yaml) in dir. Probes without an
+// id are named after their file.
+func Load(dir string) ([]*Probe, error) {
+	files := []string{}
+
+	for _, pattern := range []string{"*.yml", "*.yaml"} {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return nil, err
+		}
+
+		files = append(files, matches...)
+	}
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("No templates found in %s.", dir)
+	}
+
+	sort.Strings(files)
+
+	probes := []*Probe{}
+
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		p := &Probe{}
+		if err := yaml.UnmarshalStrict(data, p); err != nil {
+			return nil, fmt.Errorf("Could not parse template %s: %s", file, err.Error())
+		}
+
+		if p.ID == "" {
+			p.ID = strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+		}
+
+		probes = append(probes, p)
+	}
+
+	return probes, nil
+}
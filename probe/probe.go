@@ -0,0 +1,197 @@
+// Package probe contains the requests that are sent to every host, either
+// created from the paths on the command line or loaded from yaml
+// templates.
+package probe
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/dutchcoders/anam/matcher"
+)
+
+// Extractor captures a value from a response. It is matched against the
+// body, or against the values of the header when set.
+type Extractor struct {
+	Name   string `yaml:"name"`
+	Regex  string `yaml:"regex"`
+	Group  int    `yaml:"group"`
+	Header string `yaml:"header"`
+
+	re *regexp.Regexp
+}
+
+// Probe describes a single request and how to interpret its response.
+//
+//	id: git-head
+//	description: Exposed git repository
+//	severity: high
+//	method: GET
+//	path: /.git/HEAD
+//	headers:
+//	  Accept: text/plain
+//	matchers:
+//	  status: [200]
+//	  body: ["^ref: refs/"]
+//	extractors:
+//	  - name: ref
+//	    regex: "^ref: (\\S+)"
+//	    group: 1
+type Probe struct {
+	ID          string            `yaml:"id"`
+	Description string            `yaml:"description"`
+	Severity    string            `yaml:"severity"`
+	Method      string            `yaml:"method"`
+	Path        string            `yaml:"path"`
+	Headers     map[string]string `yaml:"headers"`
+	Body        string            `yaml:"body"`
+	Matchers    matcher.Spec      `yaml:"matchers"`
+	Extractors  []Extractor       `yaml:"extractors"`
+
+	// Secrets enables secret detection on the body of hits
+	Secrets bool `yaml:"secrets"`
+
+	matcher matcher.Matcher
+}
+
+// FromPath returns a GET probe for path, as given on the command line.
+func FromPath(path string, spec matcher.Spec) *Probe {
+	return &Probe{
+		ID:       path,
+		Method:   "GET",
+		Path:     path,
+		Matchers: spec,
+	}
+}
+
+// Compile validates the probe and compiles its matchers and extractors.
+// The global matchers are required to match as well.
+func (p *Probe) Compile(global *matcher.Spec) error {
+	if p.Path == "" {
+		return fmt.Errorf("Probe %s has no path.", p.ID)
+	}
+
+	if p.Method == "" {
+		p.Method = "GET"
+	}
+
+	p.Method = strings.ToUpper(p.Method)
+
+	spec := matcher.Spec{
+		And: []matcher.Spec{p.Matchers},
+	}
+
+	if global != nil {
+		spec.And = append(spec.And, *global)
+	}
+
+	if m, err := spec.Compile(); err != nil {
+		return fmt.Errorf("Invalid matcher for probe %s: %s", p.ID, err.Error())
+	} else {
+		p.matcher = m
+	}
+
+	for i := range p.Extractors {
+		e := &p.Extractors[i]
+
+		re, err := regexp.Compile(e.Regex)
+		if err != nil {
+			return fmt.Errorf("Invalid extractor for probe %s: %s", p.ID, err.Error())
+		}
+
+		if e.Group > re.NumSubexp() {
+			return fmt.Errorf("Invalid extractor for probe %s: group %d does not exist", p.ID, e.Group)
+		}
+
+		e.re = re
+	}
+
+	return nil
+}
+
+// Request returns the raw http request for host. The path is the path of
+// the probe, relative to the base path of the host.
+func (p *Probe) Request(host, path, userAgent string) []byte {
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "%s %s HTTP/1.1\r\n", p.Method, path)
+
+	// headers of the template replace the defaults
+	headers := map[string]string{}
+	for k, v := range p.Headers {
+		headers[http.CanonicalHeaderKey(k)] = v
+	}
+
+	for _, h := range [][2]string{
+		{"User-Agent", userAgent},
+		{"Host", host},
+		{"Accept", "*/*"},
+	} {
+		if v, ok := headers[h[0]]; ok {
+			h[1] = v
+			delete(headers, h[0])
+		}
+
+		fmt.Fprintf(&buf, "%s: %s\r\n", h[0], h[1])
+	}
+
+	// computed from the body
+	delete(headers, "Content-Length")
+
+	keys := make([]string, 0, len(headers))
+	for k := range headers {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		fmt.Fprintf(&buf, "%s: %s\r\n", k, headers[k])
+	}
+
+	if p.Body != "" {
+		fmt.Fprintf(&buf, "Content-Length: %d\r\n", len(p.Body))
+	}
+
+	buf.WriteString("\r\n")
+	buf.WriteString(p.Body)
+
+	return buf.Bytes()
+}
+
+// Match returns whether the response is a hit for this probe.
+func (p *Probe) Match(r *matcher.Response) bool {
+	return p.matcher.Match(r)
+}
+
+// Extract returns the values captured by the extractors.
+func (p *Probe) Extract(r *matcher.Response) map[string]string {
+	if len(p.Extractors) == 0 {
+		return nil
+	}
+
+	values := map[string]string{}
+
+	for _, e := range p.Extractors {
+		if e.Header == "" {
+			if m := e.re.FindSubmatch(r.Body); m != nil {
+				values[e.Name] = string(m[e.Group])
+			}
+
+			continue
+		}
+
+		for _, v := range r.Header[http.CanonicalHeaderKey(e.Header)] {
+			if m := e.re.FindStringSubmatch(v); m != nil {
+				values[e.Name] = m[e.Group]
+				break
+			}
+		}
+	}
+
+	return values
+}
@@ -0,0 +1,71 @@
+package probe
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dutchcoders/anam/matcher"
+)
+
+func TestRequestHeaders(t *testing.T) {
+	p := &Probe{
+		Method: "GET",
+		Headers: map[string]string{
+			"accept":     "text/plain",
+			"User-Agent": "custom",
+			"X-Test":     "1",
+		},
+	}
+
+	req := string(p.Request("example.com", "/.git/HEAD", "anam"))
+
+	for _, expected := range []string{
+		"GET /.git/HEAD HTTP/1.1\r\n",
+		"User-Agent: custom\r\n",
+		"Host: example.com\r\n",
+		"Accept: text/plain\r\n",
+		"X-Test: 1\r\n",
+	} {
+		if !strings.Contains(req, expected) {
+			t.Errorf("request lacks %q:\n%s", expected, req)
+		}
+	}
+
+	for _, header := range []string{"Accept:", "User-Agent:", "Host:"} {
+		if n := strings.Count(req, header); n != 1 {
+			t.Errorf("request has %d %s headers:\n%s", n, header, req)
+		}
+	}
+}
+
+func TestEnvTemplate(t *testing.T) {
+	probes, err := Load("../templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var env *Probe
+	for _, p := range probes {
+		if p.ID == "env" {
+			env = p
+		}
+	}
+
+	if env == nil {
+		t.Fatal("env template not found")
+	} else if err := env.Compile(&matcher.Spec{}); err != nil {
+		t.Fatal(err)
+	}
+
+	for body, expected := range map[string]bool{
+		"APP_KEY=base64:abc\nDB_HOST=localhost\n":           true,
+		"<html><body>\nAPP_KEY=x\n</body></html>":           false,
+		"<HTML><BODY>\nAPP_KEY=x\n</BODY></HTML>":           false,
+		"<!DOCTYPE html><Html lang=en>\nAPP_KEY=x\n</Html>": false,
+	} {
+		r := &matcher.Response{StatusCode: 200, Body: []byte(body)}
+		if env.Match(r) != expected {
+			t.Errorf("env template match of %q should be %v", body, expected)
+		}
+	}
+}
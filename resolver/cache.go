@@ -0,0 +1,185 @@
+package resolver
+
+import (
+	"container/heap"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type cacheEntry struct {
+	key     string
+	answer  *Answer
+	err     error
+	expires time.Time
+
+	// index in the expiry heap
+	index int
+}
+
+// expiryHeap orders the entries by expiry, the first to expire on top.
+type expiryHeap []*cacheEntry
+
+func (h expiryHeap) Len() int           { return len(h) }
+func (h expiryHeap) Less(i, j int) bool { return h[i].expires.Before(h[j].expires) }
+
+func (h expiryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index, h[j].index = i, j
+}
+
+func (h *expiryHeap) Push(x interface{}) {
+	entry := x.(*cacheEntry)
+	entry.index = len(*h)
+	*h = append(*h, entry)
+}
+
+func (h *expiryHeap) Pop() interface{} {
+	old := *h
+	entry := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return entry
+}
+
+// Cache caches the lookups of a resolver for the ttl of the records,
+// limited to MinTTL and MaxTTL when set. Non existing names, server failures
+// and empty answers are cached for NegativeTTL. Other errors, like timeouts,
+// are not cached.
+type Cache struct {
+	Resolver
+
+	NegativeTTL time.Duration
+	MinTTL      time.Duration
+	MaxTTL      time.Duration
+
+	m       sync.Mutex
+	entries map[string]*cacheEntry
+	expiry  expiryHeap
+	size    int
+
+	now func() time.Time
+
+	hits   uint64
+	misses uint64
+}
+
+// NewCache returns a cache of at most size names for the resolver.
+func NewCache(r Resolver, size int, negativeTTL time.Duration) *Cache {
+	return &Cache{
+		Resolver:    r,
+		NegativeTTL: negativeTTL,
+		entries:     map[string]*cacheEntry{},
+		size:        size,
+		now:         time.Now,
+	}
+}
+
+// Lookup returns the cached answer for host, or looks it up.
+func (c *Cache) Lookup(host string) (*Answer, error) {
+	key := strings.TrimSuffix(strings.ToLower(host), ".")
+
+	now := c.now()
+
+	c.m.Lock()
+	entry, ok := c.entries[key]
+	c.m.Unlock()
+
+	if ok && now.Before(entry.expires) {
+		atomic.AddUint64(&c.hits, 1)
+		return entry.answer, entry.err
+	}
+
+	atomic.AddUint64(&c.misses, 1)
+
+	answer, err := c.Resolver.Lookup(host)
+
+	ttl := time.Duration(0)
+	if err == ErrNXDomain || err == ErrServFail {
+		ttl = c.NegativeTTL
+	} else if err != nil {
+	} else if answer.TTL > 0 {
+		ttl = c.clamp(answer.TTL)
+	} else {
+		ttl = c.NegativeTTL
+	}
+
+	if ttl > 0 {
+		c.add(&cacheEntry{
+			key:     key,
+			answer:  answer,
+			err:     err,
+			expires: now.Add(ttl),
+		})
+	}
+
+	return answer, err
+}
+
+// LookupAddr isn't cached, addresses of ranges are looked up once.
+func (c *Cache) LookupAddr(ip net.IP) (string, error) {
+	return c.Resolver.LookupAddr(ip)
+}
+
+// clamp limits the ttl of an answer to MinTTL and MaxTTL.
+func (c *Cache) clamp(ttl time.Duration) time.Duration {
+	if c.MinTTL > 0 && ttl < c.MinTTL {
+		return c.MinTTL
+	} else if c.MaxTTL > 0 && ttl > c.MaxTTL {
+		return c.MaxTTL
+	}
+
+	return ttl
+}
+
+func (c *Cache) add(entry *cacheEntry) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if old, ok := c.entries[entry.key]; ok {
+		// concurrent or expired lookup of the same name
+		entry.index = old.index
+		c.expiry[entry.index] = entry
+		c.entries[entry.key] = entry
+		heap.Fix(&c.expiry, entry.index)
+		return
+	}
+
+	if len(c.entries) >= c.size {
+		c.evict()
+	}
+
+	c.entries[entry.key] = entry
+	heap.Push(&c.expiry, entry)
+}
+
+// evict removes the expired entries, when the cache is still full the
+// entries expiring first are removed to make room for a tenth of the size.
+func (c *Cache) evict() {
+	now := c.now()
+
+	for len(c.expiry) > 0 && !c.expiry[0].expires.After(now) {
+		c.remove()
+	}
+
+	for len(c.expiry) > 0 && len(c.entries) >= c.size-c.size/10 {
+		c.remove()
+	}
+}
+
+// remove removes the entry expiring first.
+func (c *Cache) remove() {
+	entry := heap.Pop(&c.expiry).(*cacheEntry)
+	delete(c.entries, entry.key)
+}
+
+// Stats returns the amount of lookups served from and missing the cache.
+func (c *Cache) Stats() (hits, misses uint64) {
+	if c == nil {
+		return 0, 0
+	}
+
+	return atomic.LoadUint64(&c.hits), atomic.LoadUint64(&c.misses)
+}
@@ -0,0 +1,232 @@
+package resolver
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+// fakeResolver answers with a ttl per name, names without a ttl don't
+// exist. Lookups are counted per name.
+type fakeResolver struct {
+	ttls    map[string]time.Duration
+	err     error
+	lookups map[string]int
+}
+
+func newFakeResolver(ttls map[string]time.Duration) *fakeResolver {
+	return &fakeResolver{
+		ttls:    ttls,
+		lookups: map[string]int{},
+	}
+}
+
+func (r *fakeResolver) Lookup(host string) (*Answer, error) {
+	r.lookups[host]++
+
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	ttl, ok := r.ttls[host]
+	if !ok {
+		return &Answer{}, ErrNXDomain
+	}
+
+	return &Answer{
+		Addresses: []net.IP{net.ParseIP("192.0.2.1")},
+		TTL:       ttl,
+	}, nil
+}
+
+func (r *fakeResolver) LookupAddr(ip net.IP) (string, error) {
+	return "", nil
+}
+
+// clock is a fake time for the cache, it only moves when advanced.
+type clock struct {
+	t time.Time
+}
+
+func (c *clock) now() time.Time {
+	return c.t
+}
+
+func (c *clock) advance(d time.Duration) {
+	c.t = c.t.Add(d)
+}
+
+func newTestCache(r Resolver, size int) (*Cache, *clock) {
+	clk := &clock{t: time.Unix(1500000000, 0)}
+
+	c := NewCache(r, size, 10*time.Second)
+	c.now = clk.now
+	return c, clk
+}
+
+func TestCacheTTL(t *testing.T) {
+	r := newFakeResolver(map[string]time.Duration{
+		"example.com": 60 * time.Second,
+	})
+
+	c, clk := newTestCache(r, 10)
+
+	for _, host := range []string{"example.com", "EXAMPLE.com.", "example.com"} {
+		if _, err := c.Lookup(host); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n := r.lookups["example.com"]; n != 1 {
+		t.Errorf("looked up %d times, should be cached", n)
+	}
+
+	clk.advance(59 * time.Second)
+	c.Lookup("example.com")
+
+	if n := r.lookups["example.com"]; n != 1 {
+		t.Errorf("looked up %d times before the ttl expired", n)
+	}
+
+	clk.advance(time.Second)
+	c.Lookup("example.com")
+
+	if n := r.lookups["example.com"]; n != 2 {
+		t.Errorf("looked up %d times, should be looked up again after the ttl", n)
+	}
+
+	if hits, misses := c.Stats(); hits != 3 || misses != 2 {
+		t.Errorf("stats are %d hits and %d misses, should be 3 and 2", hits, misses)
+	}
+}
+
+func TestCacheClamp(t *testing.T) {
+	r := newFakeResolver(map[string]time.Duration{
+		"short.example.com": 5 * time.Second,
+		"long.example.com":  24 * time.Hour,
+		"mid.example.com":   2 * time.Minute,
+	})
+
+	c, clk := newTestCache(r, 10)
+	c.MinTTL = time.Minute
+	c.MaxTTL = time.Hour
+
+	for k, v := range map[string]time.Duration{
+		"short.example.com": time.Minute,
+		"long.example.com":  time.Hour,
+		"mid.example.com":   2 * time.Minute,
+	} {
+		c.Lookup(k)
+
+		clk.advance(v - time.Second)
+		c.Lookup(k)
+
+		if n := r.lookups[k]; n != 1 {
+			t.Errorf("%s: looked up %d times before %s", k, n, v)
+		}
+
+		clk.advance(time.Second)
+		c.Lookup(k)
+
+		if n := r.lookups[k]; n != 2 {
+			t.Errorf("%s: looked up %d times, should expire after %s", k, n, v)
+		}
+	}
+}
+
+func TestCacheNegative(t *testing.T) {
+	r := newFakeResolver(map[string]time.Duration{
+		"empty.example.com": 0,
+	})
+
+	c, clk := newTestCache(r, 10)
+
+	for _, host := range []string{"missing.example.com", "empty.example.com"} {
+		for i := 0; i < 2; i++ {
+			if _, err := c.Lookup("missing.example.com"); err != ErrNXDomain {
+				t.Fatalf("error is %v, should be %v", err, ErrNXDomain)
+			}
+
+			c.Lookup(host)
+		}
+
+		if n := r.lookups[host]; n != 1 {
+			t.Errorf("%s: looked up %d times, should be cached", host, n)
+		}
+	}
+
+	clk.advance(10 * time.Second)
+	c.Lookup("missing.example.com")
+
+	if n := r.lookups["missing.example.com"]; n != 2 {
+		t.Errorf("looked up %d times, should expire after the negative ttl", n)
+	}
+
+	// timeouts aren't cached
+	r.err = ErrTimeout
+
+	for i := 0; i < 2; i++ {
+		if _, err := c.Lookup("timeout.example.com"); err != ErrTimeout {
+			t.Fatalf("error is %v, should be %v", err, ErrTimeout)
+		}
+	}
+
+	if n := r.lookups["timeout.example.com"]; n != 2 {
+		t.Errorf("looked up %d times, timeouts should not be cached", n)
+	}
+}
+
+func TestCacheEvict(t *testing.T) {
+	ttls := map[string]time.Duration{}
+	for i := 0; i < 20; i++ {
+		ttls[fmt.Sprintf("%d.example.com", i)] = time.Duration(100-i) * time.Second
+	}
+
+	r := newFakeResolver(ttls)
+	c, clk := newTestCache(r, 10)
+
+	// the full cache makes room for a tenth by removing the entries
+	// expiring first
+	for i := 0; i < 11; i++ {
+		c.Lookup(fmt.Sprintf("%d.example.com", i))
+	}
+
+	if len(c.entries) != 9 || len(c.expiry) != 9 {
+		t.Fatalf("cache has %d entries, should be 9", len(c.entries))
+	}
+
+	if _, ok := c.entries["9.example.com"]; ok {
+		t.Error("the entry expiring first should be evicted")
+	} else if _, ok := c.entries["0.example.com"]; !ok {
+		t.Error("the entry expiring last should be kept")
+	}
+
+	// expired entries are removed first
+	c.Lookup("11.example.com")
+
+	clk.advance(95 * time.Second)
+
+	c.Lookup("12.example.com")
+
+	if len(c.entries) != 6 {
+		t.Errorf("cache has %d entries, expired entries should be evicted", len(c.entries))
+	}
+
+	// expired entries are replaced
+	clk.advance(10 * time.Second)
+
+	for i := 0; i < 2; i++ {
+		c.Lookup("0.example.com")
+	}
+
+	if n := r.lookups["0.example.com"]; n != 2 {
+		t.Errorf("looked up %d times, should be looked up again", n)
+	}
+
+	for i, entry := range c.expiry {
+		if entry.index != i || c.entries[entry.key] != entry {
+			t.Fatalf("entry %s is at %d, has index %d", entry.key, i, entry.index)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package resolver
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const dnsMessageType = "application/dns-message"
+
+type httpsExchanger struct {
+	url    string
+	client *http.Client
+}
+
+// NewHTTPSExchanger returns an exchanger sending queries over https (rfc
+// 8484) to the url, the path defaults to /dns-query. The certificate is
+// verified using config, or the system roots when config is nil.
+func NewHTTPSExchanger(rawurl string, config *tls.Config) (Exchanger, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	} else if u.Scheme != "https" {
+		return nil, fmt.Errorf("Resolver %s is not an https url.", rawurl)
+	} else if u.Host == "" {
+		return nil, fmt.Errorf("Resolver %s has no host.", rawurl)
+	}
+
+	if u.Path == "" {
+		u.Path = "/dns-query"
+	}
+
+	transport := &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		TLSClientConfig:     config,
+		ForceAttemptHTTP2:   true,
+		MaxIdleConnsPerHost: maxIdleConns,
+		IdleConnTimeout:     90 * time.Second,
+	}
+
+	return &httpsExchanger{
+		url: u.String(),
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   queryTimeout,
+		},
+	}, nil
+}
+
+// Exchange posts the query. The id is sent as 0 to make responses
+// cacheable, as recommended by the rfc. Rate limited queries return
+// ErrRefused.
+func (e *httpsExchanger) Exchange(m *dns.Msg) (*dns.Msg, error) {
+	query := m.Copy()
+	query.Id = 0
+
+	data, err := query.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", e.url, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", dnsMessageType)
+	req.Header.Set("Accept", dnsMessageType)
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return nil, ErrRefused
+	} else if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Unexpected status %s from %s.", resp.Status, e.url)
+	} else if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, dnsMessageType) {
+		return nil, fmt.Errorf("Unexpected content type %s from %s.", ct, e.url)
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, dns.MaxMsgSize))
+	if err != nil {
+		return nil, err
+	}
+
+	in := new(dns.Msg)
+	if err := in.Unpack(body); err != nil {
+		return nil, err
+	}
+
+	in.Id = m.Id
+	return in, nil
+}
+
+func (e *httpsExchanger) String() string {
+	return e.url
+}
@@ -0,0 +1,116 @@
+package resolver
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func dohServer(t *testing.T) *httptest.Server {
+	return httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		m := new(dns.Msg)
+		if err := m.Unpack(body); err != nil {
+			t.Error(err)
+			return
+		} else if m.Id != 0 {
+			t.Errorf("query has id %d, should be 0", m.Id)
+		}
+
+		switch r.URL.Path {
+		case "/limited":
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		case "/html":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte("<html></html>"))
+			return
+		}
+
+		resp := new(dns.Msg)
+		resp.SetReply(m)
+
+		data, err := resp.Pack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		w.Header().Set("Content-Type", dnsMessageType)
+		w.Write(data)
+	}))
+}
+
+func clientConfig(srv *httptest.Server) *tls.Config {
+	return srv.Client().Transport.(*http.Transport).TLSClientConfig.Clone()
+}
+
+func TestHTTPSExchange(t *testing.T) {
+	srv := dohServer(t)
+	defer srv.Close()
+
+	ex, err := NewHTTPSExchanger(srv.URL, clientConfig(srv))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := new(dns.Msg)
+	m.SetQuestion("example.com.", dns.TypeA)
+
+	in, err := ex.Exchange(m)
+	if err != nil {
+		t.Fatal(err)
+	} else if in.Id != m.Id {
+		t.Errorf("response has id %d, should be %d", in.Id, m.Id)
+	} else if len(in.Question) != 1 || in.Question[0].Name != "example.com." {
+		t.Errorf("unexpected question %v", in.Question)
+	}
+}
+
+func TestHTTPSExchangeErrors(t *testing.T) {
+	srv := dohServer(t)
+	defer srv.Close()
+
+	m := new(dns.Msg)
+	m.SetQuestion("example.com.", dns.TypeA)
+
+	ex, err := NewHTTPSExchanger(srv.URL+"/limited", clientConfig(srv))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ex.Exchange(m); err != ErrRefused {
+		t.Errorf("rate limited query returned %v, should be %v", err, ErrRefused)
+	}
+
+	ex, err = NewHTTPSExchanger(srv.URL+"/html", clientConfig(srv))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if in, err := ex.Exchange(m); err == nil {
+		t.Errorf("response with wrong content type returned %v", in)
+	}
+}
+
+func TestHTTPSExchangerURL(t *testing.T) {
+	if _, err := NewHTTPSExchanger("http://example.com/dns-query", nil); err == nil {
+		t.Error("http url should be refused")
+	}
+
+	ex, err := NewHTTPSExchanger("https://example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	} else if s := ex.String(); s != "https://example.com/dns-query" {
+		t.Errorf("url is %s, should default to /dns-query", s)
+	}
+}
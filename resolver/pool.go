@@ -0,0 +1,307 @@
+package resolver
+
+import (
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	// timeout of a single query
+	queryTimeout = 2 * time.Second
+
+	// consecutive failures before an upstream is ejected
+	ejectAfter = 5
+
+	// time an upstream is ejected, doubled for every successive ejection
+	ejectTime    = 30 * time.Second
+	maxEjectTime = 8 * time.Minute
+)
+
+// Exchanger sends queries to a single upstream resolver.
+type Exchanger interface {
+	Exchange(m *dns.Msg) (*dns.Msg, error)
+	String() string
+}
+
+type udpExchanger struct {
+	addr   string
+	client *dns.Client
+}
+
+// NewUDPExchanger returns an exchanger sending queries over udp to addr.
+func NewUDPExchanger(addr string) Exchanger {
+	return &udpExchanger{
+		addr:   addr,
+		client: &dns.Client{Timeout: queryTimeout},
+	}
+}
+
+func (e *udpExchanger) Exchange(m *dns.Msg) (*dns.Msg, error) {
+	in, _, err := e.client.Exchange(m, e.addr)
+	return in, err
+}
+
+func (e *udpExchanger) String() string {
+	return e.addr
+}
+
+// UpstreamStats contains the counters of an upstream resolver.
+type UpstreamStats struct {
+	Name string
+
+	Queries   uint64
+	Timeouts  uint64
+	ServFails uint64
+	Refused   uint64
+	Errors    uint64
+
+	// Latency is the moving average of the response time
+	Latency   time.Duration
+	Ejections int
+}
+
+type upstream struct {
+	m sync.Mutex
+
+	ex Exchanger
+
+	// rate limit, the time the next query is allowed
+	interval time.Duration
+	next     time.Time
+
+	stats UpstreamStats
+
+	failures int
+	backoff  uint
+	ejected  time.Time
+}
+
+// wait blocks until the rate limit allows the next query.
+func (u *upstream) wait() {
+	if u.interval == 0 {
+		return
+	}
+
+	u.m.Lock()
+
+	now := time.Now()
+	if u.next.Before(now) {
+		u.next = now
+	}
+
+	at := u.next
+	u.next = u.next.Add(u.interval)
+
+	u.m.Unlock()
+
+	time.Sleep(at.Sub(now))
+}
+
+// record updates the counters with the outcome of a query. Timeouts,
+// refused queries and network errors count as failures of the upstream,
+// other responses not. Server failures are mostly caused by broken zones.
+func (u *upstream) record(in *dns.Msg, err error, rtt time.Duration) {
+	u.m.Lock()
+	defer u.m.Unlock()
+
+	u.stats.Queries++
+
+	switch {
+	case err == ErrServFail:
+		u.stats.ServFails++
+	case err == ErrTimeout:
+		u.stats.Timeouts++
+	case err == ErrRefused:
+		u.stats.Refused++
+	case in == nil:
+		u.stats.Errors++
+	}
+
+	if in != nil && err != ErrRefused {
+		if u.stats.Latency == 0 {
+			u.stats.Latency = rtt
+		} else {
+			u.stats.Latency = (u.stats.Latency*7 + rtt) / 8
+		}
+
+		u.failures = 0
+		u.backoff = 0
+		return
+	}
+
+	u.failures++
+	if u.failures < ejectAfter {
+		return
+	}
+
+	d := ejectTime << u.backoff
+	if d > maxEjectTime {
+		d = maxEjectTime
+	} else {
+		u.backoff++
+	}
+
+	u.ejected = time.Now().Add(d)
+	u.failures = 0
+	u.stats.Ejections++
+}
+
+func (u *upstream) healthy(now time.Time) bool {
+	u.m.Lock()
+	defer u.m.Unlock()
+
+	return now.After(u.ejected)
+}
+
+func (u *upstream) ejectedUntil() time.Time {
+	u.m.Lock()
+	defer u.m.Unlock()
+
+	return u.ejected
+}
+
+func (u *upstream) latency() time.Duration {
+	u.m.Lock()
+	defer u.m.Unlock()
+
+	return u.stats.Latency
+}
+
+// Pool distributes queries over upstream resolvers. Unhealthy upstreams are
+// ejected temporarily and every upstream is limited to QPS queries per
+// second.
+type Pool struct {
+	upstreams []*upstream
+}
+
+// NewPool returns a pool of the exchangers, qps 0 disables rate limiting.
+func NewPool(exchangers []Exchanger, qps int) *Pool {
+	p := &Pool{}
+
+	for _, ex := range exchangers {
+		u := &upstream{
+			ex: ex,
+		}
+
+		u.stats.Name = ex.String()
+
+		if qps > 0 {
+			u.interval = time.Second / time.Duration(qps)
+		}
+
+		p.upstreams = append(p.upstreams, u)
+	}
+
+	return p
+}
+
+// Len returns the amount of upstreams.
+func (p *Pool) Len() int {
+	return len(p.upstreams)
+}
+
+// pick returns an upstream not tried yet, preferring healthy upstreams with
+// low latency. When all upstreams are ejected, the one ejected first is
+// returned.
+func (p *Pool) pick(tried map[*upstream]bool) *upstream {
+	now := time.Now()
+
+	candidates := []*upstream{}
+	for _, u := range p.upstreams {
+		if u.healthy(now) && !tried[u] {
+			candidates = append(candidates, u)
+		}
+	}
+
+	if len(candidates) == 0 {
+		for _, u := range p.upstreams {
+			if u.healthy(now) {
+				candidates = append(candidates, u)
+			}
+		}
+	}
+
+	if len(candidates) == 0 {
+		first, until := p.upstreams[0], p.upstreams[0].ejectedUntil()
+		for _, u := range p.upstreams[1:] {
+			if t := u.ejectedUntil(); t.Before(until) {
+				first, until = u, t
+			}
+		}
+
+		return first
+	}
+
+	// power of two choices
+	a, b := candidates[rand.Intn(len(candidates))], candidates[rand.Intn(len(candidates))]
+	if b.latency() < a.latency() {
+		return b
+	}
+
+	return a
+}
+
+// Exchange sends the query to an upstream, retrying failed queries at
+// other upstreams up to retries times. The response is returned together
+// with the error of its response code.
+func (p *Pool) Exchange(m *dns.Msg, retries int) (*dns.Msg, error) {
+	if len(p.upstreams) == 0 {
+		return nil, ErrNoServers
+	}
+
+	tried := map[*upstream]bool{}
+
+	var (
+		in  *dns.Msg
+		err error
+	)
+
+	for attempt := 0; attempt <= retries; attempt++ {
+		u := p.pick(tried)
+		tried[u] = true
+
+		u.wait()
+
+		start := time.Now()
+
+		in, err = u.ex.Exchange(m)
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			err = ErrTimeout
+		} else if err == nil {
+			err = rcodeError(in)
+		}
+
+		u.record(in, err, time.Since(start))
+
+		switch err {
+		case ErrTimeout, ErrServFail, ErrRefused:
+			continue
+		}
+
+		if in == nil {
+			// network errors
+			continue
+		}
+
+		return in, err
+	}
+
+	return in, err
+}
+
+// Stats returns the counters of the upstreams.
+func (p *Pool) Stats() []UpstreamStats {
+	stats := []UpstreamStats{}
+
+	for _, u := range p.upstreams {
+		u.m.Lock()
+		stats = append(stats, u.stats)
+		u.m.Unlock()
+	}
+
+	return stats
+}
@@ -0,0 +1,206 @@
+package resolver
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+var _ net.Error = timeoutError{}
+
+// fakeExchanger answers every query with the response code, or fails with
+// err when set.
+type fakeExchanger struct {
+	name  string
+	rcode int
+	err   error
+
+	m       sync.Mutex
+	queries int
+}
+
+func (e *fakeExchanger) Exchange(m *dns.Msg) (*dns.Msg, error) {
+	e.m.Lock()
+	e.queries++
+	e.m.Unlock()
+
+	if e.err != nil {
+		return nil, e.err
+	}
+
+	in := new(dns.Msg)
+	in.SetRcode(m, e.rcode)
+	return in, nil
+}
+
+func (e *fakeExchanger) String() string {
+	return e.name
+}
+
+func (e *fakeExchanger) count() int {
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	return e.queries
+}
+
+func query() *dns.Msg {
+	m := new(dns.Msg)
+	m.SetQuestion("example.com.", dns.TypeA)
+	return m
+}
+
+func TestPoolRcodes(t *testing.T) {
+	for _, c := range []struct {
+		rcode int
+		err   error
+		fails bool
+	}{
+		{dns.RcodeSuccess, nil, false},
+		{dns.RcodeNameError, ErrNXDomain, false},
+		{dns.RcodeServerFailure, ErrServFail, false},
+		{dns.RcodeRefused, ErrRefused, true},
+	} {
+		e := &fakeExchanger{name: "a", rcode: c.rcode}
+		p := NewPool([]Exchanger{e}, 0)
+
+		for i := 0; i < ejectAfter; i++ {
+			if _, err := p.Exchange(query(), 0); err != c.err {
+				t.Errorf("%s: error is %v, should be %v", dns.RcodeToString[c.rcode], err, c.err)
+			}
+		}
+
+		stats := p.Stats()[0]
+		if ejected := stats.Ejections > 0; ejected != c.fails {
+			t.Errorf("%s: ejected is %v, should be %v", dns.RcodeToString[c.rcode], ejected, c.fails)
+		}
+	}
+}
+
+func TestPoolCounters(t *testing.T) {
+	timeout := &fakeExchanger{name: "timeout", err: timeoutError{}}
+	broken := &fakeExchanger{name: "broken", err: errors.New("connection refused")}
+
+	p := NewPool([]Exchanger{timeout, broken}, 0)
+
+	if _, err := p.Exchange(query(), 1); err == nil {
+		t.Fatal("query should fail")
+	}
+
+	// the retry goes to the other upstream
+	if timeout.count() != 1 || broken.count() != 1 {
+		t.Errorf("upstreams got %d and %d queries, should get 1", timeout.count(), broken.count())
+	}
+
+	for _, stats := range p.Stats() {
+		switch stats.Name {
+		case "timeout":
+			if stats.Timeouts != 1 {
+				t.Errorf("timeouts is %d, should be 1", stats.Timeouts)
+			}
+		case "broken":
+			if stats.Errors != 1 {
+				t.Errorf("errors is %d, should be 1", stats.Errors)
+			}
+		}
+	}
+}
+
+func TestPoolEjection(t *testing.T) {
+	bad := &fakeExchanger{name: "bad", err: timeoutError{}}
+	good := &fakeExchanger{name: "good"}
+
+	p := NewPool([]Exchanger{bad, good}, 0)
+
+	for i := 0; i < 20; i++ {
+		if _, err := p.Exchange(query(), 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// bad is ejected after ejectAfter failures and not picked anymore
+	if n := bad.count(); n != ejectAfter {
+		t.Errorf("ejected upstream got %d queries, should get %d", n, ejectAfter)
+	}
+
+	// all upstreams ejected, the one ejected first is used
+	good.err = timeoutError{}
+	for i := 0; i < ejectAfter; i++ {
+		p.Exchange(query(), 0)
+	}
+
+	if u := p.pick(map[*upstream]bool{}); u.ex != bad {
+		t.Errorf("picked %s, should pick the upstream ejected first", u.ex)
+	}
+}
+
+func TestUpstreamBackoff(t *testing.T) {
+	u := &upstream{ex: &fakeExchanger{name: "a"}}
+
+	fail := func() time.Duration {
+		for i := 0; i < ejectAfter; i++ {
+			u.record(nil, ErrTimeout, 0)
+		}
+
+		return time.Until(u.ejectedUntil())
+	}
+
+	for _, expected := range []time.Duration{ejectTime, 2 * ejectTime, 4 * ejectTime} {
+		if d := fail(); d > expected || d < expected-time.Second {
+			t.Errorf("ejected for %v, should be %v", d, expected)
+		}
+	}
+
+	for i := 0; i < 10; i++ {
+		fail()
+	}
+
+	if d := fail(); d > maxEjectTime || d < maxEjectTime-time.Second {
+		t.Errorf("ejected for %v, should be capped at %v", d, maxEjectTime)
+	}
+
+	// a response resets the backoff
+	u.record(new(dns.Msg), nil, time.Millisecond)
+
+	if d := fail(); d > ejectTime || d < ejectTime-time.Second {
+		t.Errorf("ejected for %v after a response, should be %v", d, ejectTime)
+	}
+
+	if u.stats.Ejections != 15 {
+		t.Errorf("ejections is %d, should be 15", u.stats.Ejections)
+	}
+}
+
+func TestPoolQPS(t *testing.T) {
+	e := &fakeExchanger{name: "a"}
+	p := NewPool([]Exchanger{e}, 100)
+
+	start := time.Now()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			p.Exchange(query(), 0)
+		}()
+	}
+
+	wg.Wait()
+
+	// the first query is sent immediately, the others 10ms apart
+	if d := time.Since(start); d < 90*time.Millisecond {
+		t.Errorf("10 queries took %v, should take at least 90ms at 100 qps", d)
+	}
+}
@@ -0,0 +1,273 @@
+package resolver
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Resolver resolves the names of the hosts to scan.
+type Resolver interface {
+	// Lookup returns the addresses of host and the canonical names
+	// followed. For non existing names ErrNXDomain is returned, together
+	// with the canonical names followed up to the missing one.
+	Lookup(host string) (*Answer, error)
+
+	// LookupAddr returns the name of the address, an empty string when it
+	// has none
+	LookupAddr(ip net.IP) (string, error)
+}
+
+// Answer is the outcome of a lookup.
+type Answer struct {
+	// CNAMEs contains the chain of canonical names, in order
+	CNAMEs    []string
+	Addresses []net.IP
+
+	// TTL is the lowest ttl of the records, 0 without records
+	TTL time.Duration
+}
+
+// maximum length of cname chains
+const maxCNAMEs = 16
+
+var ErrNoServers = errors.New("No resolvers configured.")
+
+var (
+	ErrNXDomain = errors.New(dns.RcodeToString[dns.RcodeNameError])
+	ErrServFail = errors.New(dns.RcodeToString[dns.RcodeServerFailure])
+	ErrRefused  = errors.New(dns.RcodeToString[dns.RcodeRefused])
+	ErrTimeout  = errors.New("Query timed out.")
+)
+
+// DNSResolver resolves names using plain dns queries to a pool of servers.
+type DNSResolver struct {
+	Pool       *Pool
+	RetryTimes int
+
+	// IPv6 queries AAAA records besides A records
+	IPv6 bool
+}
+
+// New returns a resolver for the servers. Servers are plain dns servers,
+// using port 53 when they have no port, dns over tls servers like
+// tls://host or dns over https urls like https://host/dns-query. Every
+// server is limited to qps queries per second, 0 means unlimited.
+func New(servers []string, qps int) (*DNSResolver, error) {
+	exchangers := []Exchanger{}
+
+	for _, server := range servers {
+		if server = strings.TrimSpace(server); server == "" {
+		} else if ex, err := NewExchanger(server); err != nil {
+			return nil, err
+		} else {
+			exchangers = append(exchangers, ex)
+		}
+	}
+
+	return NewWithExchangers(exchangers, qps), nil
+}
+
+// NewExchanger returns the exchanger for the server, by its scheme.
+func NewExchanger(server string) (Exchanger, error) {
+	if strings.HasPrefix(server, "tls://") {
+		return NewTLSExchanger(strings.TrimPrefix(server, "tls://"), nil)
+	} else if strings.HasPrefix(server, "https://") {
+		return NewHTTPSExchanger(server, nil)
+	} else if strings.Contains(server, "://") {
+		return nil, fmt.Errorf("Resolver %s has an unsupported scheme.", server)
+	}
+
+	return NewUDPExchanger(address(server)), nil
+}
+
+// NewWithExchangers returns a resolver sending the queries using the
+// exchangers.
+func NewWithExchangers(exchangers []Exchanger, qps int) *DNSResolver {
+	return &DNSResolver{
+		Pool:       NewPool(exchangers, qps),
+		RetryTimes: len(exchangers) * 2,
+	}
+}
+
+// NewFromResolvConf returns a resolver for the servers of a resolv.conf like
+// file.
+func NewFromResolvConf(path string, qps int) (*DNSResolver, error) {
+	servers, err := ResolvConf(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return New(servers, qps)
+}
+
+// ResolvConf returns the servers of a resolv.conf like file.
+func ResolvConf(path string) ([]string, error) {
+	config, err := dns.ClientConfigFromFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return config.Servers, nil
+}
+
+// address returns the host:port address of the server, port 53 is used
+// when the server has no port.
+func address(server string) string {
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(strings.Trim(server, "[]"), "53")
+	}
+
+	return server
+}
+
+// LookupHost returns the addresses of host.
+func (r *DNSResolver) LookupHost(host string) ([]net.IP, error) {
+	answer, err := r.Lookup(host)
+	if err != nil {
+		return nil, err
+	}
+
+	return answer.Addresses, nil
+}
+
+// Lookup returns the addresses and canonical names of host. Timeouts,
+// server failures and refused queries are retried RetryTimes times at other
+// servers.
+func (r *DNSResolver) Lookup(host string) (*Answer, error) {
+	types := []uint16{dns.TypeA}
+	if r.IPv6 {
+		types = append(types, dns.TypeAAAA)
+	}
+
+	answer := &Answer{}
+
+	for i, t := range types {
+		in, err := r.exchange(dns.Fqdn(host), t)
+		if i == 0 && in != nil {
+			answer.CNAMEs = Chain(host, in)
+		}
+
+		if err == nil {
+		} else if len(answer.Addresses) > 0 {
+			// keep the ipv4 addresses when the AAAA query fails
+			break
+		} else {
+			return answer, err
+		}
+
+		answer.Addresses = append(answer.Addresses, Addresses(in)...)
+		answer.TTL = minTTL(answer.TTL, in)
+	}
+
+	return answer, nil
+}
+
+// Chain returns the canonical names followed from name in the answer
+// section of the message.
+func Chain(name string, in *dns.Msg) []string {
+	cnames := []string{}
+
+	current := dns.Fqdn(name)
+
+	for len(cnames) < maxCNAMEs {
+		found := false
+
+		for _, rr := range in.Answer {
+			if cname, ok := rr.(*dns.CNAME); !ok {
+			} else if !strings.EqualFold(cname.Hdr.Name, current) {
+			} else {
+				current = cname.Target
+				cnames = append(cnames, strings.TrimSuffix(current, "."))
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			break
+		}
+	}
+
+	return cnames
+}
+
+// minTTL returns the lowest ttl of ttl and the records in the answer
+// section of the message, a ttl of 0 means no records have been seen.
+func minTTL(ttl time.Duration, in *dns.Msg) time.Duration {
+	for _, rr := range in.Answer {
+		if v := time.Duration(rr.Header().Ttl) * time.Second; ttl == 0 || v < ttl {
+			ttl = v
+		}
+	}
+
+	return ttl
+}
+
+// Addresses returns the A and AAAA records in the answer section of the
+// message.
+func Addresses(in *dns.Msg) []net.IP {
+	ips := []net.IP{}
+
+	for _, record := range in.Answer {
+		switch v := record.(type) {
+		case *dns.A:
+			ips = append(ips, v.A)
+		case *dns.AAAA:
+			ips = append(ips, v.AAAA)
+		}
+	}
+
+	return ips
+}
+
+// LookupAddr returns the name of the PTR record of the address.
+func (r *DNSResolver) LookupAddr(ip net.IP) (string, error) {
+	arpa, err := dns.ReverseAddr(ip.String())
+	if err != nil {
+		return "", err
+	}
+
+	in, err := r.exchange(arpa, dns.TypePTR)
+	if err != nil {
+		return "", err
+	}
+
+	for _, rr := range in.Answer {
+		if ptr, ok := rr.(*dns.PTR); ok {
+			return strings.TrimSuffix(ptr.Ptr, "."), nil
+		}
+	}
+
+	return "", nil
+}
+
+// rcodeError returns the error for the response code of the message, the
+// message itself is still returned as non existing names can have cnames.
+func rcodeError(in *dns.Msg) error {
+	switch in.Rcode {
+	case dns.RcodeSuccess:
+		return nil
+	case dns.RcodeNameError:
+		return ErrNXDomain
+	case dns.RcodeServerFailure:
+		return ErrServFail
+	case dns.RcodeRefused:
+		return ErrRefused
+	default:
+		return errors.New(dns.RcodeToString[in.Rcode])
+	}
+}
+
+// exchange returns the response to the query, together with the error of
+// its response code.
+func (r *DNSResolver) exchange(name string, t uint16) (*dns.Msg, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(name, t)
+
+	return r.Pool.Exchange(m, r.RetryTimes)
+}
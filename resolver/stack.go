@@ -0,0 +1,242 @@
+// +build amd64,linux
+
+package resolver
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dutchcoders/anam/netstack"
+	"github.com/miekg/dns"
+)
+
+// source ports of the queries, above the ephemeral ports of the kernel
+const (
+	stackPortFirst = 61000
+	stackPortLast  = 65535
+)
+
+type stackKey struct {
+	server string
+	port   uint16
+	id     uint16
+}
+
+type stackQuery struct {
+	question dns.Question
+	ch       chan *dns.Msg
+}
+
+// udpSender sends udp packets, it is implemented by the network stack.
+type udpSender interface {
+	SendUDP(dst net.IP, sport, dport uint16, payload []byte) error
+}
+
+// StackClient sends queries as udp packets of the network stack, instead of
+// using a socket per query. Responses are matched to the queries by server,
+// source port and id.
+type StackClient struct {
+	s udpSender
+
+	Timeout time.Duration
+
+	m       sync.Mutex
+	pending map[stackKey]*stackQuery
+}
+
+// NewStackClient returns a client sending queries using the stack. It is
+// created before the stack is started, which is needed to receive the
+// responses.
+func NewStackClient(s *netstack.Stack) (*StackClient, error) {
+	c := &StackClient{
+		s:       s,
+		Timeout: queryTimeout,
+		pending: map[stackKey]*stackQuery{},
+	}
+
+	if err := s.HandleUDP(c.handle); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// NewStack returns a resolver for the servers sending plain queries using
+// the stack, port 53 is used when the server has no port. Dns over tls and
+// https servers use sockets.
+func NewStack(s *netstack.Stack, servers []string, qps int) (*DNSResolver, error) {
+	c, err := NewStackClient(s)
+	if err != nil {
+		return nil, err
+	}
+
+	exchangers := []Exchanger{}
+
+	for _, server := range servers {
+		if server = strings.TrimSpace(server); server == "" {
+		} else if strings.Contains(server, "://") {
+			if ex, err := NewExchanger(server); err != nil {
+				return nil, err
+			} else {
+				exchangers = append(exchangers, ex)
+			}
+		} else if ex, err := c.Exchanger(address(server)); err != nil {
+			return nil, err
+		} else {
+			exchangers = append(exchangers, ex)
+		}
+	}
+
+	return NewWithExchangers(exchangers, qps), nil
+}
+
+type stackExchanger struct {
+	c    *StackClient
+	ip   net.IP
+	port uint16
+	addr string
+}
+
+// Exchanger returns an exchanger for the server, which needs to be an
+// address as names can't be resolved.
+func (c *StackClient) Exchanger(server string) (Exchanger, error) {
+	host, port, err := net.SplitHostPort(server)
+	if err != nil {
+		return nil, err
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return nil, fmt.Errorf("Resolver %s is not an address.", server)
+	} else if ip.IsLoopback() {
+		return nil, fmt.Errorf("Resolver %s is a loopback address, which the network stack can't reach.", server)
+	}
+
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("Resolver %s has an invalid port.", server)
+	}
+
+	return &stackExchanger{
+		c:    c,
+		ip:   ip,
+		port: uint16(p),
+		addr: net.JoinHostPort(ip.String(), port),
+	}, nil
+}
+
+func (e *stackExchanger) Exchange(m *dns.Msg) (*dns.Msg, error) {
+	return e.c.exchange(e.ip, e.port, e.addr, m)
+}
+
+func (e *stackExchanger) String() string {
+	return e.addr
+}
+
+// exchange sends the query from a random source port with a random id.
+// Truncated responses are retried over tcp.
+func (c *StackClient) exchange(ip net.IP, port uint16, addr string, m *dns.Msg) (*dns.Msg, error) {
+	if len(m.Question) != 1 {
+		return nil, fmt.Errorf("Expected a single question, got %d.", len(m.Question))
+	}
+
+	q := &stackQuery{
+		question: m.Question[0],
+		ch:       make(chan *dns.Msg, 1),
+	}
+
+	var key stackKey
+
+	c.m.Lock()
+	for {
+		key = stackKey{
+			server: addr,
+			port:   uint16(stackPortFirst + rand.Intn(stackPortLast-stackPortFirst+1)),
+			id:     uint16(rand.Intn(0x10000)),
+		}
+
+		if _, ok := c.pending[key]; !ok {
+			break
+		}
+	}
+
+	c.pending[key] = q
+	c.m.Unlock()
+
+	defer func() {
+		c.m.Lock()
+		delete(c.pending, key)
+		c.m.Unlock()
+	}()
+
+	query := m.Copy()
+	query.Id = key.id
+
+	data, err := query.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.s.SendUDP(ip, key.port, port, data); err != nil {
+		return nil, err
+	}
+
+	timer := time.NewTimer(c.Timeout)
+	defer timer.Stop()
+
+	select {
+	case in := <-q.ch:
+		if !in.Truncated {
+			return in, nil
+		}
+
+		client := &dns.Client{Net: "tcp", Timeout: c.Timeout}
+
+		in, _, err := client.Exchange(m, addr)
+		return in, err
+	case <-timer.C:
+		return nil, ErrTimeout
+	}
+}
+
+// handle passes responses to the pending queries, other packets and
+// responses not matching the question are ignored.
+func (c *StackClient) handle(p *netstack.UDPPacket) {
+	if p.DestinationPort < stackPortFirst || len(p.Payload) < 12 {
+		return
+	}
+
+	key := stackKey{
+		server: net.JoinHostPort(p.Src.String(), strconv.Itoa(int(p.SourcePort))),
+		port:   p.DestinationPort,
+		id:     binary.BigEndian.Uint16(p.Payload),
+	}
+
+	c.m.Lock()
+	q, ok := c.pending[key]
+	c.m.Unlock()
+
+	if !ok {
+		return
+	}
+
+	in := new(dns.Msg)
+	if err := in.Unpack(p.Payload); err != nil {
+		return
+	} else if !in.Response || len(in.Question) != 1 {
+		return
+	} else if question := in.Question[0]; question.Qtype != q.question.Qtype || !strings.EqualFold(question.Name, q.question.Name) {
+		return
+	}
+
+	select {
+	case q.ch <- in:
+	default:
+	}
+}
@@ -0,0 +1,164 @@
+// +build amd64,linux
+
+package resolver
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/dutchcoders/anam/netstack"
+	"github.com/miekg/dns"
+)
+
+// fakeSender answers queries by passing the packets returned by respond to
+// the client.
+type fakeSender struct {
+	c       *StackClient
+	respond func(q *udpQuery) []*netstack.UDPPacket
+}
+
+type udpQuery struct {
+	dst          net.IP
+	sport, dport uint16
+	msg          *dns.Msg
+}
+
+func (s *fakeSender) SendUDP(dst net.IP, sport, dport uint16, payload []byte) error {
+	m := new(dns.Msg)
+	if err := m.Unpack(payload); err != nil {
+		return err
+	}
+
+	for _, p := range s.respond(&udpQuery{dst, sport, dport, m}) {
+		s.c.handle(p)
+	}
+
+	return nil
+}
+
+// reply returns the response packet to the query, modify changes it before
+// it is packed.
+func reply(q *udpQuery, modify func(p *netstack.UDPPacket, m *dns.Msg)) *netstack.UDPPacket {
+	m := new(dns.Msg)
+	m.SetReply(q.msg)
+	m.Answer = append(m.Answer, &dns.A{
+		Hdr: dns.RR_Header{Name: q.msg.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+		A:   net.ParseIP("192.0.2.80"),
+	})
+
+	p := &netstack.UDPPacket{
+		Src:             q.dst,
+		SourcePort:      q.dport,
+		DestinationPort: q.sport,
+	}
+
+	if modify != nil {
+		modify(p, m)
+	}
+
+	data, err := m.Pack()
+	if err != nil {
+		panic(err)
+	}
+
+	p.Payload = data
+	return p
+}
+
+func newTestClient(respond func(q *udpQuery) []*netstack.UDPPacket) (*StackClient, Exchanger) {
+	s := &fakeSender{respond: respond}
+
+	c := &StackClient{
+		s:       s,
+		Timeout: 100 * time.Millisecond,
+		pending: map[stackKey]*stackQuery{},
+	}
+
+	s.c = c
+
+	ex, err := c.Exchanger("192.0.2.53:53")
+	if err != nil {
+		panic(err)
+	}
+
+	return c, ex
+}
+
+func TestStackClientMatch(t *testing.T) {
+	var original uint16
+
+	_, ex := newTestClient(func(q *udpQuery) []*netstack.UDPPacket {
+		if q.msg.Id == original {
+			t.Error("query is sent with the id of the caller")
+		} else if q.sport < stackPortFirst {
+			t.Errorf("query is sent from port %d", q.sport)
+		}
+
+		// the valid response comes last, the others have no answers and
+		// would take its place when they weren't dropped
+		packets := []*netstack.UDPPacket{}
+		for _, modify := range []func(p *netstack.UDPPacket, m *dns.Msg){
+			func(p *netstack.UDPPacket, m *dns.Msg) { m.Id++ },
+			func(p *netstack.UDPPacket, m *dns.Msg) { p.DestinationPort++ },
+			func(p *netstack.UDPPacket, m *dns.Msg) { p.Src = net.ParseIP("192.0.2.54") },
+			func(p *netstack.UDPPacket, m *dns.Msg) { p.SourcePort = 5353 },
+			func(p *netstack.UDPPacket, m *dns.Msg) { m.Question[0].Name = "example.org." },
+			func(p *netstack.UDPPacket, m *dns.Msg) { m.Response = false },
+		} {
+			modify := modify
+			packets = append(packets, reply(q, func(p *netstack.UDPPacket, m *dns.Msg) {
+				modify(p, m)
+				m.Answer = nil
+			}))
+		}
+
+		return append(packets, reply(q, nil))
+	})
+
+	m := new(dns.Msg)
+	m.SetQuestion("example.com.", dns.TypeA)
+	original = m.Id
+
+	in, err := ex.Exchange(m)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(in.Answer) != 1 {
+		t.Fatalf("response has %d answers", len(in.Answer))
+	}
+}
+
+func TestStackClientMismatch(t *testing.T) {
+	modifications := []func(p *netstack.UDPPacket, m *dns.Msg){
+		func(p *netstack.UDPPacket, m *dns.Msg) { m.Id++ },
+		func(p *netstack.UDPPacket, m *dns.Msg) { p.DestinationPort++ },
+		func(p *netstack.UDPPacket, m *dns.Msg) { p.Src = net.ParseIP("192.0.2.54") },
+		func(p *netstack.UDPPacket, m *dns.Msg) { p.SourcePort = 5353 },
+		func(p *netstack.UDPPacket, m *dns.Msg) { m.Question[0].Qtype = dns.TypeAAAA },
+	}
+
+	for i, modify := range modifications {
+		c, ex := newTestClient(func(q *udpQuery) []*netstack.UDPPacket {
+			return []*netstack.UDPPacket{reply(q, modify)}
+		})
+
+		m := new(dns.Msg)
+		m.SetQuestion("example.com.", dns.TypeA)
+
+		if in, err := ex.Exchange(m); err != ErrTimeout {
+			t.Errorf("modification %d: response should be dropped, got %v, %v", i, in, err)
+		}
+
+		if len(c.pending) != 0 {
+			t.Errorf("modification %d: %d queries still pending", i, len(c.pending))
+		}
+	}
+}
+
+func TestStackClientLoopback(t *testing.T) {
+	c, _ := newTestClient(nil)
+
+	if _, err := c.Exchanger("127.0.0.1:53"); err == nil {
+		t.Error("loopback resolver should be refused")
+	}
+}
@@ -0,0 +1,126 @@
+package resolver
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// maximum idle connections kept per dns over tls server
+const maxIdleConns = 16
+
+type tlsExchanger struct {
+	addr   string
+	config *tls.Config
+
+	m    sync.Mutex
+	idle []*dns.Conn
+}
+
+// NewTLSExchanger returns an exchanger sending queries over tls (rfc 7858)
+// to server, port 853 is used when it has no port. Connections are reused
+// between queries. The certificate is verified for the host of server when
+// config is nil or has no server name.
+func NewTLSExchanger(server string, config *tls.Config) (Exchanger, error) {
+	host, port, err := net.SplitHostPort(server)
+	if err != nil {
+		host, port = strings.Trim(server, "[]"), "853"
+	}
+
+	if host == "" {
+		return nil, fmt.Errorf("Resolver %s has no host.", server)
+	}
+
+	if config == nil {
+		config = &tls.Config{}
+	} else {
+		config = config.Clone()
+	}
+
+	if config.ServerName == "" {
+		config.ServerName = host
+	}
+
+	return &tlsExchanger{
+		addr:   net.JoinHostPort(host, port),
+		config: config,
+	}, nil
+}
+
+// Exchange sends the query over an idle or new connection. Idle connections
+// may have been closed by the server, failures on them are retried once on a
+// new connection.
+func (e *tlsExchanger) Exchange(m *dns.Msg) (*dns.Msg, error) {
+	for {
+		conn, reused, err := e.get()
+		if err != nil {
+			return nil, err
+		}
+
+		in, err := e.exchange(conn, m)
+		if err == nil {
+			e.put(conn)
+			return in, nil
+		}
+
+		conn.Close()
+
+		if ne, ok := err.(net.Error); !reused || (ok && ne.Timeout()) {
+			return nil, err
+		}
+	}
+}
+
+func (e *tlsExchanger) exchange(conn *dns.Conn, m *dns.Msg) (*dns.Msg, error) {
+	conn.SetDeadline(time.Now().Add(queryTimeout))
+
+	if err := conn.WriteMsg(m); err != nil {
+		return nil, err
+	}
+
+	in, err := conn.ReadMsg()
+	if err != nil {
+		return nil, err
+	} else if in.Id != m.Id {
+		return nil, dns.ErrId
+	}
+
+	return in, nil
+}
+
+// get returns an idle connection, or dials a new one.
+func (e *tlsExchanger) get() (*dns.Conn, bool, error) {
+	e.m.Lock()
+	if n := len(e.idle); n > 0 {
+		conn := e.idle[n-1]
+		e.idle = e.idle[:n-1]
+		e.m.Unlock()
+
+		return conn, true, nil
+	}
+	e.m.Unlock()
+
+	conn, err := dns.DialTimeoutWithTLS("tcp", e.addr, e.config, queryTimeout)
+	return conn, false, err
+}
+
+func (e *tlsExchanger) put(conn *dns.Conn) {
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	if len(e.idle) >= maxIdleConns {
+		conn.Close()
+		return
+	}
+
+	e.idle = append(e.idle, conn)
+}
+
+func (e *tlsExchanger) String() string {
+	return "tls://" + e.addr
+}
@@ -0,0 +1,140 @@
+package resolver
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// dotServer answers queries over tls and returns the address and the
+// amount of accepted connections. With closeAfter the connection is closed
+// after every response.
+func dotServer(t *testing.T, config *tls.Config, closeAfter bool) (net.Listener, *int32) {
+	l, err := tls.Listen("tcp", "127.0.0.1:0", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var accepted int32
+
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			atomic.AddInt32(&accepted, 1)
+
+			go func() {
+				conn := &dns.Conn{Conn: c}
+				defer conn.Close()
+
+				for {
+					m, err := conn.ReadMsg()
+					if err != nil {
+						return
+					}
+
+					resp := new(dns.Msg)
+					resp.SetReply(m)
+
+					if err := conn.WriteMsg(resp); err != nil || closeAfter {
+						return
+					}
+				}
+			}()
+		}
+	}()
+
+	return l, &accepted
+}
+
+// tlsConfigs returns a server and a matching client configuration, using
+// the certificate of httptest for example.com.
+func tlsConfigs() (*tls.Config, *tls.Config) {
+	srv := httptest.NewTLSServer(nil)
+	defer srv.Close()
+
+	server := &tls.Config{
+		Certificates: srv.TLS.Certificates,
+	}
+
+	client := clientConfig(srv)
+	client.ServerName = "example.com"
+	return server, client
+}
+
+func exchangeN(t *testing.T, ex Exchanger, n int) {
+	for i := 0; i < n; i++ {
+		m := new(dns.Msg)
+		m.SetQuestion("example.com.", dns.TypeA)
+
+		in, err := ex.Exchange(m)
+		if err != nil {
+			t.Fatal(err)
+		} else if in.Id != m.Id {
+			t.Fatalf("response has id %d, should be %d", in.Id, m.Id)
+		}
+	}
+}
+
+func TestTLSExchangeReuse(t *testing.T) {
+	server, client := tlsConfigs()
+
+	l, accepted := dotServer(t, server, false)
+	defer l.Close()
+
+	ex, err := NewTLSExchanger(l.Addr().String(), client)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exchangeN(t, ex, 3)
+
+	if n := atomic.LoadInt32(accepted); n != 1 {
+		t.Errorf("queries used %d connections, should reuse 1", n)
+	}
+}
+
+func TestTLSExchangeClosed(t *testing.T) {
+	server, client := tlsConfigs()
+
+	l, accepted := dotServer(t, server, true)
+	defer l.Close()
+
+	ex, err := NewTLSExchanger(l.Addr().String(), client)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the idle connection is closed by the server, the query is retried
+	exchangeN(t, ex, 3)
+
+	if n := atomic.LoadInt32(accepted); n != 3 {
+		t.Errorf("queries used %d connections, should use 3", n)
+	}
+}
+
+func TestTLSExchangeVerify(t *testing.T) {
+	server, _ := tlsConfigs()
+
+	l, _ := dotServer(t, server, false)
+	defer l.Close()
+
+	ex, err := NewTLSExchanger(l.Addr().String(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := new(dns.Msg)
+	m.SetQuestion("example.com.", dns.TypeA)
+
+	if _, err := ex.Exchange(m); err == nil {
+		t.Error("unverified certificate should be refused")
+	}
+}
@@ -0,0 +1,156 @@
+package scanner
+
+import (
+	"bytes"
+	"encoding/hex"
+	"hash/fnv"
+	"math"
+	"math/bits"
+	"math/rand"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/dutchcoders/anam/matcher"
+	"github.com/dutchcoders/anam/probe"
+)
+
+var titleRegexp = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+
+// fingerprint summarizes a response, it is used to recognize the generic
+// page servers return for any path (soft-404).
+type fingerprint struct {
+	method  string
+	status  int
+	bucket  int
+	simhash uint64
+	title   string
+}
+
+// newFingerprint returns the fingerprint of the response to a request of
+// method. Responses to HEAD requests have no body, their size is taken from
+// the Content-Length header.
+func newFingerprint(method string, r *matcher.Response) fingerprint {
+	size := len(r.Body)
+	if method != "HEAD" {
+	} else if n, err := strconv.Atoi(r.Header.Get("Content-Length")); err == nil && n > 0 {
+		size = n
+	}
+
+	f := fingerprint{
+		method:  method,
+		status:  r.StatusCode,
+		bucket:  int(math.Log(float64(size+1)) * 8),
+		simhash: simhash(r.Body),
+	}
+
+	if m := titleRegexp.FindSubmatch(r.Body); m != nil {
+		f.title = strings.ToLower(strings.TrimSpace(string(m[1])))
+	}
+
+	return f
+}
+
+// similar returns whether both responses are most likely the same page.
+// Small differences are allowed, as soft-404 pages often contain the
+// requested path.
+func (f fingerprint) similar(o fingerprint) bool {
+	if f.method != o.method || f.status != o.status {
+		return false
+	}
+
+	// responses to HEAD requests have no body to compare, only their size
+	distance := bits.OnesCount64(f.simhash ^ o.simhash)
+	if distance <= 3 && f.method != "HEAD" {
+		return true
+	}
+
+	return f.bucket == o.bucket && f.title == o.title && distance <= 12
+}
+
+func simhash(data []byte) uint64 {
+	var v [64]int
+
+	tokens := bytes.FieldsFunc(data, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	for _, token := range tokens {
+		h := fnv.New64a()
+		h.Write(bytes.ToLower(token))
+
+		sum := h.Sum64()
+		for i := uint(0); i < 64; i++ {
+			if sum&(1<<i) != 0 {
+				v[i]++
+			} else {
+				v[i]--
+			}
+		}
+	}
+
+	var hash uint64
+	for i := uint(0); i < 64; i++ {
+		if v[i] > 0 {
+			hash |= 1 << i
+		}
+	}
+
+	return hash
+}
+
+func randomPath(i int) string {
+	b := make([]byte, 8)
+	rand.Read(b)
+
+	// alternate between plain paths and dot files, as servers tend to
+	// handle those differently
+	if i%2 == 1 {
+		return "/." + hex.EncodeToString(b)
+	}
+
+	return "/" + hex.EncodeToString(b)
+}
+
+// baseline requests random, nonexistent paths using method and returns the
+// fingerprints of the responses. When the baseline fails the scan continues
+// without it, soft-404 responses aren't filtered then.
+func (a *Scanner) baseline(s *session, host Host, method string) []fingerprint {
+	fingerprints := []fingerprint{}
+
+	for i := 0; i < a.config.Baseline; i++ {
+		p := probe.FromPath(randomPath(i), matcher.Spec{})
+		p.ID = "baseline"
+		p.Method = method
+
+		r := a.newResult(host, p)
+		if err := s.request(p, r); err != nil {
+			return nil
+		}
+
+		fingerprints = append(fingerprints, newFingerprint(method, &matcher.Response{
+			StatusCode: r.Status,
+			Header:     r.Header,
+			Body:       r.Body,
+		}))
+	}
+
+	return fingerprints
+}
+
+func isBaseline(fingerprints []fingerprint, method string, r *matcher.Response) bool {
+	if len(fingerprints) == 0 {
+		return false
+	}
+
+	f := newFingerprint(method, r)
+
+	for _, b := range fingerprints {
+		if b.similar(f) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,45 @@
+package scanner
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/dutchcoders/anam/matcher"
+)
+
+func response(status int, body string, length int) *matcher.Response {
+	return &matcher.Response{
+		StatusCode: status,
+		Header:     http.Header{"Content-Length": {strconv.Itoa(length)}},
+		Body:       []byte(body),
+	}
+}
+
+func TestIsBaseline(t *testing.T) {
+	page := "<html><head><title>Not found</title></head><body><h1>Not found</h1><p>The page /%s could not be found on this server. It may have been moved or deleted, or the address may contain a typo. Please check the address, or go back to the home page and use the navigation or the search box to find what you are looking for.</p><footer>Copyright Example Corporation, all rights reserved.</footer></body></html>"
+
+	get := []fingerprint{newFingerprint("GET", response(200, strings.Replace(page, "%s", "3f2a9c", 1), 0))}
+	head := []fingerprint{newFingerprint("HEAD", response(200, "", 5123))}
+
+	for _, c := range []struct {
+		fingerprints []fingerprint
+		method       string
+		r            *matcher.Response
+		expected     bool
+	}{
+		{get, "GET", response(200, strings.Replace(page, "%s", ".git/HEAD", 1), 0), true},
+		{get, "GET", response(200, "ref: refs/heads/master\n", 0), false},
+		{get, "GET", response(404, strings.Replace(page, "%s", ".git/HEAD", 1), 0), false},
+		// HEAD responses are only compared to a HEAD baseline, by size
+		{get, "HEAD", response(200, "", 5123), false},
+		{head, "HEAD", response(200, "", 5200), true},
+		{head, "HEAD", response(200, "", 10485760), false},
+		{nil, "GET", response(200, "", 0), false},
+	} {
+		if isBaseline(c.fingerprints, c.method, c.r) != c.expected {
+			t.Errorf("%s %d %q (%s) should be baseline: %v", c.method, c.r.StatusCode, c.r.Body, c.r.Header.Get("Content-Length"), c.expected)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package scanner
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// Checkpoint keeps track of which input lines have been fully resolved and
+// scanned, so an interrupted scan can be resumed. Lines are identified by
+// their position in the input.
+type Checkpoint struct {
+	m sync.Mutex
+
+	path string
+
+	// every line below next has been completed
+	next      int
+	completed map[int]struct{}
+
+	// outstanding lookups and scans per line
+	pending map[int]int
+}
+
+type checkpointState struct {
+	Next      int   `json:"next"`
+	Completed []int `json:"completed"`
+}
+
+// NewCheckpoint returns a checkpoint persisted to path. When resume is set
+// the previous state is read from path.
+func NewCheckpoint(path string, resume bool) (*Checkpoint, error) {
+	c := &Checkpoint{
+		path:      path,
+		completed: map[int]struct{}{},
+		pending:   map[int]int{},
+	}
+
+	if !resume {
+		return c, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	state := checkpointState{}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+
+	c.next = state.Next
+	for _, line := range state.Completed {
+		c.completed[line] = struct{}{}
+	}
+
+	return c, nil
+}
+
+// Count returns the number of completed lines.
+func (c *Checkpoint) Count() int {
+	if c == nil {
+		return 0
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	return c.next + len(c.completed)
+}
+
+// Completed returns whether line has been completed before.
+func (c *Checkpoint) Completed(line int) bool {
+	if c == nil {
+		return false
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if line < c.next {
+		return true
+	}
+
+	_, ok := c.completed[line]
+	return ok
+}
+
+func (c *Checkpoint) acquire(line int) {
+	if c == nil {
+		return
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.pending[line]++
+}
+
+func (c *Checkpoint) release(line int) {
+	if c == nil {
+		return
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.pending[line]--
+	if c.pending[line] > 0 {
+		return
+	}
+
+	delete(c.pending, line)
+
+	c.completed[line] = struct{}{}
+
+	for {
+		if _, ok := c.completed[c.next]; !ok {
+			break
+		}
+
+		delete(c.completed, c.next)
+		c.next++
+	}
+}
+
+// Save writes the checkpoint to the state file.
+func (c *Checkpoint) Save() error {
+	if c == nil {
+		return nil
+	}
+
+	c.m.Lock()
+
+	state := checkpointState{
+		Next:      c.next,
+		Completed: make([]int, 0, len(c.completed)),
+	}
+
+	for line := range c.completed {
+		state.Completed = append(state.Completed, line)
+	}
+
+	c.m.Unlock()
+
+	sort.Ints(state.Completed)
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(c.path), ".anam-state")
+	if err != nil {
+		return err
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	// the state has to survive a reboot
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), c.path)
+}
@@ -0,0 +1,68 @@
+package scanner
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/fatih/color"
+	"github.com/mattn/go-colorable"
+)
+
+// ConsoleWriter prints results as coloured lines to stdout.
+type ConsoleWriter struct {
+	m   sync.Mutex
+	out io.Writer
+}
+
+func NewConsoleWriter() *ConsoleWriter {
+	return &ConsoleWriter{
+		out: colorable.NewColorableStdout(),
+	}
+}
+
+func (w *ConsoleWriter) Write(r *Result) error {
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	switch r.ErrorClass {
+	case ErrorNone:
+		if r.Probe == takeoverProbe && len(r.Findings) > 0 {
+			details := r.Findings[0].Details
+			fmt.Fprintln(w.out, color.RedString("Possible takeover of host %s, %s points to an unclaimed %s resource (%s).", r.Host, details["cname"], details["service"], details["reason"]))
+			break
+		}
+
+		if len(r.Secrets) > 0 {
+			// never print the body of responses containing secrets
+			fmt.Fprintln(w.out, color.YellowString("Got statuscode %d for host %s(%s) on path %s, found %d secrets.", r.Status, r.Host, r.IP.String(), r.Path, len(r.Secrets)))
+
+			for _, s := range r.Secrets {
+				fmt.Fprintln(w.out, color.RedString("    %s (line %d): %s", s.Rule, s.Line, s.Redacted))
+			}
+
+			break
+		}
+
+		snippet := r.Body
+		if len(snippet) > 20 {
+			snippet = snippet[:20]
+		}
+
+		fmt.Fprintln(w.out, color.YellowString("Got statuscode %d for host %s(%s) on path %s: %s.", r.Status, r.Host, r.IP.String(), r.Path, string(snippet)))
+	case ErrorConnect, ErrorTLS:
+		fmt.Fprintln(w.out, color.RedString("[%s]: Connect failed (%s): %s", r.Host, r.IP.String(), r.Error))
+	default:
+		fmt.Fprintln(w.out, color.RedString("[%s]: %s failed (%s) on path %s: %s", r.Host, r.ErrorClass, r.IP.String(), r.Path, r.Error))
+	}
+
+	return nil
+}
+
+func (w *ConsoleWriter) Flush() error {
+	return nil
+}
+
+func (w *ConsoleWriter) Close() error {
+	return nil
+}
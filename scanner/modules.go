@@ -0,0 +1,78 @@
+package scanner
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dutchcoders/anam/config"
+	"github.com/dutchcoders/anam/matcher"
+	"github.com/dutchcoders/anam/probe"
+	"github.com/dutchcoders/anam/verify"
+	"github.com/dutchcoders/anam/verify/git"
+	"github.com/dutchcoders/anam/verify/svn"
+)
+
+func compileModules(config *config.Config) ([]verify.Module, error) {
+	modules := []verify.Module{}
+
+	for _, name := range strings.Split(config.Verify, ",") {
+		switch strings.TrimSpace(name) {
+		case "":
+		case "git":
+			modules = append(modules, git.New(config.GitDump, config.GitMaxObjects))
+		case "svn":
+			modules = append(modules, svn.New())
+		default:
+			return nil, fmt.Errorf("Unknown verification module: %s", name)
+		}
+	}
+
+	return modules, nil
+}
+
+// fetcher requests additional paths over the connection of a scan.
+type fetcher struct {
+	a    *Scanner
+	s    *session
+	host Host
+}
+
+func (f *fetcher) Fetch(path string) (int, []byte, error) {
+	p := probe.FromPath(path, matcher.Spec{})
+
+	r := f.a.newResult(f.host, p)
+	if err := f.s.request(p, r); err != nil {
+		return 0, nil, err
+	}
+
+	return r.Status, r.Body, nil
+}
+
+// verify runs the modules applying to the path of the hit, that haven't run
+// for this host yet. An error is returned when the connection can't be used
+// anymore.
+func (a *Scanner) verify(f *fetcher, done map[string]bool, path string, r *Result) error {
+	for _, m := range a.modules {
+		if done[m.Name()] || !m.Applies(path) {
+			continue
+		}
+
+		done[m.Name()] = true
+
+		finding, err := m.Verify(r.Host, f)
+		if err != nil {
+			r.Findings = append(r.Findings, &verify.Finding{
+				Module: m.Name(),
+				Details: map[string]interface{}{
+					"error": err.Error(),
+				},
+			})
+
+			return err
+		}
+
+		r.Findings = append(r.Findings, finding)
+	}
+
+	return nil
+}
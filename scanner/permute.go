@@ -0,0 +1,112 @@
+package scanner
+
+import (
+	"math/big"
+	"math/bits"
+	"math/rand"
+)
+
+// permutation visits 0..n-1 in a random order without keeping state per
+// element. It walks the multiplicative group modulo a prime p > n, starting
+// at a random element and multiplying by a primitive root, skipping the
+// elements beyond n.
+type permutation struct {
+	n, p, g uint64
+
+	start, x uint64
+	started  bool
+}
+
+func newPermutation(n uint64) *permutation {
+	p := n + 1
+	for !big.NewInt(0).SetUint64(p).ProbablyPrime(20) {
+		p++
+	}
+
+	return &permutation{
+		n:     n,
+		p:     p,
+		g:     primitiveRoot(p),
+		start: 1 + uint64(rand.Int63n(int64(p-1))),
+	}
+}
+
+// next returns the next index, false when all indexes have been returned.
+func (pm *permutation) next() (uint64, bool) {
+	for {
+		if !pm.started {
+			pm.started = true
+			pm.x = pm.start
+		} else if pm.x = mulmod(pm.x, pm.g, pm.p); pm.x == pm.start {
+			return 0, false
+		}
+
+		if pm.x <= pm.n {
+			return pm.x - 1, true
+		}
+	}
+}
+
+// primitiveRoot returns a random generator of the multiplicative group
+// modulo the prime p.
+func primitiveRoot(p uint64) uint64 {
+	if p <= 3 {
+		return p - 1
+	}
+
+	factors := primeFactors(p - 1)
+
+	for {
+		g := 2 + uint64(rand.Int63n(int64(p-3)))
+
+		ok := true
+		for _, q := range factors {
+			if powmod(g, (p-1)/q, p) == 1 {
+				ok = false
+				break
+			}
+		}
+
+		if ok {
+			return g
+		}
+	}
+}
+
+func primeFactors(n uint64) []uint64 {
+	factors := []uint64{}
+	for q := uint64(2); q*q <= n; q++ {
+		if n%q != 0 {
+			continue
+		}
+
+		factors = append(factors, q)
+		for n%q == 0 {
+			n /= q
+		}
+	}
+
+	if n > 1 {
+		factors = append(factors, n)
+	}
+
+	return factors
+}
+
+func mulmod(a, b, m uint64) uint64 {
+	hi, lo := bits.Mul64(a, b)
+	return bits.Rem64(hi, lo, m)
+}
+
+func powmod(b, e, m uint64) uint64 {
+	r := uint64(1)
+	for b %= m; e > 0; e >>= 1 {
+		if e&1 == 1 {
+			r = mulmod(r, b, m)
+		}
+
+		b = mulmod(b, b, m)
+	}
+
+	return r
+}
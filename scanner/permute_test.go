@@ -0,0 +1,44 @@
+package scanner
+
+import "testing"
+
+func TestPermutation(t *testing.T) {
+	for _, n := range []uint64{0, 1, 2, 3, 10, 256, 1000, 65536} {
+		pm := newPermutation(n)
+
+		seen := make([]bool, n)
+		count := uint64(0)
+
+		for {
+			i, ok := pm.next()
+			if !ok {
+				break
+			}
+
+			if i >= n {
+				t.Fatalf("n=%d: index %d out of range", n, i)
+			} else if seen[i] {
+				t.Fatalf("n=%d: index %d returned twice", n, i)
+			}
+
+			seen[i] = true
+			count++
+		}
+
+		if count != n {
+			t.Errorf("n=%d: returned %d indexes", n, count)
+		}
+	}
+}
+
+func TestPowmod(t *testing.T) {
+	for _, c := range []struct{ b, e, m, r uint64 }{
+		{2, 10, 1000, 24},
+		{3, 0, 7, 1},
+		{1 << 62, 2, 1<<61 - 1, 4},
+	} {
+		if r := powmod(c.b, c.e, c.m); r != c.r {
+			t.Errorf("%d^%d mod %d is %d, should be %d", c.b, c.e, c.m, r, c.r)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package scanner
+
+import (
+	"bufio"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/fatih/color"
+
+	"github.com/dutchcoders/anam/config"
+)
+
+// concurrent lookups of the prefixes of a single domain
+const prefixWorkers = 8
+
+type prefixStat struct {
+	resolved uint64
+	hits     uint64
+}
+
+// loadPrefixes returns the prefixes from the prefix flag and the prefix
+// file, starting with the empty prefix for the domain itself.
+func loadPrefixes(config *config.Config) ([]string, error) {
+	prefixes := []string{""}
+
+	seen := map[string]bool{"": true}
+
+	add := func(prefix string) {
+		prefix = strings.Trim(strings.ToLower(strings.TrimSpace(prefix)), ".")
+		if seen[prefix] {
+			return
+		}
+
+		seen[prefix] = true
+		prefixes = append(prefixes, prefix)
+	}
+
+	for _, prefix := range strings.Split(config.Prefix, ",") {
+		add(prefix)
+	}
+
+	if config.PrefixFile == "" {
+		return prefixes, nil
+	}
+
+	f, err := os.Open(config.PrefixFile)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		if text := strings.TrimSpace(s.Text()); strings.HasPrefix(text, "#") {
+			continue
+		} else {
+			add(text)
+		}
+	}
+
+	return prefixes, s.Err()
+}
+
+// lookupPrefixes resolves the domain with every prefix prepended. Domains
+// with wildcard dns are detected first, to scan their wildcard addresses
+// once.
+func (a *Scanner) lookupPrefixes(host Host, domain string) {
+	// excluded domains exclude their prefixed names as well, no queries are
+	// sent for them
+	if a.exclude.MatchName(domain) {
+		atomic.AddUint64(&a.excludedNames, 1)
+		return
+	}
+
+	var w *wildcard
+	if len(a.prefixes) > 1 {
+		w = a.detectWildcard(domain)
+	}
+
+	ch := make(chan string)
+
+	var wg sync.WaitGroup
+
+	workers := prefixWorkers
+	if len(a.prefixes) < workers {
+		workers = len(a.prefixes)
+	}
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+
+		go func(host Host) {
+			defer wg.Done()
+
+			for prefix := range ch {
+				host.Prefix = prefix
+
+				host.Name = domain
+				if prefix != "" {
+					host.Name = strings.Join([]string{prefix, domain}, ".")
+				}
+
+				a.resolveHost(host, w)
+			}
+		}(host)
+	}
+
+	for _, prefix := range a.prefixes {
+		ch <- prefix
+	}
+
+	close(ch)
+
+	wg.Wait()
+}
+
+func (a *Scanner) prefixResolved(host Host) {
+	if stat, ok := a.prefixStats[host.Prefix]; ok {
+		atomic.AddUint64(&stat.resolved, 1)
+	}
+}
+
+func (a *Scanner) prefixHit(host Host) {
+	if stat, ok := a.prefixStats[host.Prefix]; ok {
+		atomic.AddUint64(&stat.hits, 1)
+	}
+}
+
+// reportPrefixes prints the prefixes that yielded resolving names, the
+// prefixes with most hits first.
+func (a *Scanner) reportPrefixes() {
+	prefixes := []string{}
+	for prefix, stat := range a.prefixStats {
+		if atomic.LoadUint64(&stat.resolved) > 0 {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+
+	sort.Slice(prefixes, func(i, j int) bool {
+		si, sj := a.prefixStats[prefixes[i]], a.prefixStats[prefixes[j]]
+		if si.hits != sj.hits {
+			return si.hits > sj.hits
+		} else if si.resolved != sj.resolved {
+			return si.resolved > sj.resolved
+		}
+
+		return prefixes[i] < prefixes[j]
+	})
+
+	color.Yellow("%d of %d prefixes resolved.", len(prefixes), len(a.prefixes))
+
+	for _, prefix := range prefixes {
+		stat := a.prefixStats[prefix]
+
+		name := prefix
+		if name == "" {
+			name = "(none)"
+		}
+
+		color.Yellow("Prefix %s: %d names resolved, %d hits.", name, stat.resolved, stat.hits)
+	}
+}
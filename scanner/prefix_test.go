@@ -0,0 +1,47 @@
+package scanner
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/dutchcoders/anam/config"
+)
+
+func TestLoadPrefixes(t *testing.T) {
+	f, err := ioutil.TempFile("", "anam-prefixes")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Remove(f.Name())
+
+	f.WriteString("# common prefixes\nwww\n\n   \ndev\n  # indented comment\nWWW\n.staging.\n\tapi \nmail.\n")
+	f.Close()
+
+	for _, c := range []struct {
+		prefix   string
+		file     string
+		prefixes []string
+	}{
+		{"", "", []string{""}},
+		{"www,mail", "", []string{"", "www", "mail"}},
+		{"www, ,WWW.,mail,", "", []string{"", "www", "mail"}},
+		{"", f.Name(), []string{"", "www", "dev", "staging", "api", "mail"}},
+		{"mail,test", f.Name(), []string{"", "mail", "test", "www", "dev", "staging", "api"}},
+	} {
+		prefixes, err := loadPrefixes(&config.Config{Prefix: c.prefix, PrefixFile: c.file})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(prefixes, c.prefixes) {
+			t.Errorf("prefixes of %q and %q are %q, should be %q", c.prefix, c.file, prefixes, c.prefixes)
+		}
+	}
+
+	if _, err := loadPrefixes(&config.Config{PrefixFile: f.Name() + ".missing"}); err == nil {
+		t.Error("loading a missing prefix file should fail")
+	}
+}
@@ -0,0 +1,84 @@
+package scanner
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/dutchcoders/anam/secrets"
+	"github.com/dutchcoders/anam/verify"
+)
+
+// ErrorClass describes the stage of a probe in which an error occurred.
+type ErrorClass string
+
+const (
+	ErrorNone    ErrorClass = ""
+	ErrorConnect ErrorClass = "connect"
+	ErrorTLS     ErrorClass = "tls"
+	ErrorWrite   ErrorClass = "write"
+	ErrorRead    ErrorClass = "read"
+	ErrorBody    ErrorClass = "body"
+)
+
+// Result is the outcome of a single probe against a host.
+type Result struct {
+	Host string `json:"host"`
+	IP   net.IP `json:"ip"`
+	Port int    `json:"port"`
+	TLS  bool   `json:"tls"`
+
+	CNAMEs   []string `json:"cnames,omitempty"`
+	Wildcard bool     `json:"wildcard,omitempty"`
+
+	Probe    string `json:"probe,omitempty"`
+	Severity string `json:"severity,omitempty"`
+	Method   string `json:"method,omitempty"`
+	Path     string `json:"path,omitempty"`
+
+	Status     int         `json:"status,omitempty"`
+	Header     http.Header `json:"headers,omitempty"`
+	BodyLength int         `json:"body_length"`
+	BodyHash   string      `json:"body_hash,omitempty"`
+
+	Extracted map[string]string `json:"extracted,omitempty"`
+	Findings  []*verify.Finding `json:"findings,omitempty"`
+	Secrets   []secrets.Secret  `json:"secrets,omitempty"`
+
+	Time     time.Time     `json:"time"`
+	Duration time.Duration `json:"duration_ns"`
+
+	ErrorClass ErrorClass `json:"error_class,omitempty"`
+	Error      string     `json:"error,omitempty"`
+
+	// Body is kept for writers that want to show a snippet, it is
+	// never serialized.
+	Body []byte `json:"-"`
+}
+
+func (r *Result) setError(err error) {
+	r.ErrorClass = ErrorConnect
+	if se, ok := err.(*scanError); ok {
+		r.ErrorClass = se.Class
+	}
+
+	r.Error = err.Error()
+}
+
+// ResultWriter receives the results of a scan. Implementations should be
+// safe for concurrent use. Flush writes buffered results to the output, it
+// is called before the checkpoint marks their lines as completed.
+type ResultWriter interface {
+	Write(*Result) error
+	Flush() error
+	Close() error
+}
+
+type scanError struct {
+	Class ErrorClass
+	Err   error
+}
+
+func (e *scanError) Error() string {
+	return e.Err.Error()
+}
@@ -5,37 +5,101 @@ package scanner
 import (
 	"bufio"
 	"context"
+	crand "crypto/rand"
+	"crypto/sha256"
 	"crypto/tls"
-	"fmt"
-	"io"
+	"encoding/hex"
 	"io/ioutil"
 	_ "log"
+	"math/rand"
 	"net"
 	"net/http"
 	_ "net/http/pprof"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/bogdanovich/dns_resolver"
 	"github.com/fatih/color"
 
+	"github.com/dutchcoders/anam/bloom"
 	"github.com/dutchcoders/anam/config"
-	"github.com/dutchcoders/netstack"
+	"github.com/dutchcoders/anam/exclude"
+	"github.com/dutchcoders/anam/matcher"
+	"github.com/dutchcoders/anam/netstack"
+	"github.com/dutchcoders/anam/probe"
+	"github.com/dutchcoders/anam/resolver"
+	"github.com/dutchcoders/anam/secrets"
+	"github.com/dutchcoders/anam/takeover"
+	"github.com/dutchcoders/anam/verify"
 )
 
 type Host struct {
 	Name string
 	IP   net.IP
+
+	TLS  bool
+	Port int
+
+	// Prefix the domain has been expanded with
+	Prefix string
+
+	// CNAMEs contains the canonical names the name resolved through
+	CNAMEs []string
+
+	// Wildcard marks names resolving to the wildcard addresses of the
+	// domain
+	Wildcard bool
+
+	// Path is prepended to the paths of the probes
+	Path string
+
+	// position of the input line the host originates from
+	line int
 }
 
 type Scanner struct {
 	hostsCh         chan string
 	resolvedHostsCh chan Host
 
-	resolver *dns_resolver.DnsResolver
+	resolver resolver.Resolver
+	cache    *resolver.Cache
+	pool     *resolver.Pool
+	writer   ResultWriter
 	s        *netstack.Stack
 	config   *config.Config
+
+	checkpoint *Checkpoint
+	probes     []*probe.Probe
+	modules    []verify.Module
+
+	prefixes    []string
+	prefixStats map[string]*prefixStat
+
+	exclude *exclude.List
+	shard   *shard
+
+	fingerprints []*takeover.Fingerprint
+
+	// names and cnames checked for takeovers, a name resolving to multiple
+	// addresses is checked once
+	takeoverChecked sync.Map
+
+	detector *secrets.Detector
+
+	// excluded names before, and addresses after resolving
+	excludedNames     uint64
+	excludedAddresses uint64
+
+	// names seen before resolving, targets seen before connecting
+	names   *bloom.Filter
+	targets *bloom.Filter
+
+	duplicateNames   uint64
+	duplicateTargets uint64
+
+	wildcardDomains   uint64
+	wildcardCollapsed uint64
 }
 
 func New(config *config.Config) (*Scanner, error) {
@@ -43,6 +107,7 @@ func New(config *config.Config) (*Scanner, error) {
 		hostsCh:         make(chan string, 100),
 		resolvedHostsCh: make(chan Host, 100),
 
+		writer: NewConsoleWriter(),
 		config: config,
 	}
 
@@ -52,19 +117,158 @@ func New(config *config.Config) (*Scanner, error) {
 		a.s = v
 	}
 
-	if resolver, err := dns_resolver.NewFromResolvConf("/etc/resolv.conf"); err != nil {
+	if servers, err := resolver.ResolvConf("/etc/resolv.conf"); err != nil {
+		return nil, err
+	} else if r, err := a.NewResolver(servers); err != nil {
+		return nil, err
+	} else {
+		r.RetryTimes = 5
+
+		a.SetResolver(r)
+	}
+
+	if probes, err := compileProbes(config); err != nil {
+		return nil, err
+	} else {
+		a.probes = probes
+	}
+
+	if modules, err := compileModules(config); err != nil {
+		return nil, err
+	} else {
+		a.modules = modules
+	}
+
+	if prefixes, err := loadPrefixes(config); err != nil {
 		return nil, err
 	} else {
-		resolver.RetryTimes = 5
+		a.prefixes = prefixes
+		a.prefixStats = map[string]*prefixStat{}
 
-		a.resolver = resolver
+		for _, prefix := range prefixes {
+			a.prefixStats[prefix] = &prefixStat{}
+		}
+	}
+
+	if config.Takeover == "" {
+	} else if fingerprints, err := takeover.Load(config.Takeover); err != nil {
+		return nil, err
+	} else {
+		a.fingerprints = fingerprints
+	}
+
+	if config.SecretsKey != "" {
+		a.detector = secrets.New([]byte(config.SecretsKey))
+	} else {
+		key := make([]byte, 32)
+		if _, err := crand.Read(key); err != nil {
+			return nil, err
+		}
+
+		a.detector = secrets.New(key)
+	}
+
+	if config.DedupSize > 0 {
+		a.names = bloom.New(uint64(config.DedupSize), 0.001)
+		a.targets = bloom.New(uint64(config.DedupSize), 0.001)
+	}
+
+	if shard, err := parseShard(config.Shard); err != nil {
+		return nil, err
+	} else {
+		a.shard = shard
+	}
+
+	if len(config.Exclude) == 0 {
+	} else if list, err := exclude.Load(config.Exclude...); err != nil {
+		return nil, err
+	} else {
+		a.exclude = list
+	}
+
+	if config.StateFile == "" {
+	} else if checkpoint, err := NewCheckpoint(config.StateFile, config.Resume); err != nil {
+		return nil, err
+	} else {
+		a.checkpoint = checkpoint
 	}
 
 	return &a, nil
 }
 
-func (a *Scanner) SetResolver(resolver *dns_resolver.DnsResolver) {
-	a.resolver = resolver
+// compileProbes returns the probes for the paths and the templates. The
+// match flags apply to all of them.
+func compileProbes(config *config.Config) ([]*probe.Probe, error) {
+	global, err := config.MatchSpec()
+	if err != nil {
+		return nil, err
+	}
+
+	probes := []*probe.Probe{}
+
+	for _, path := range config.Paths {
+		probes = append(probes, probe.FromPath(path, config.Matchers[path]))
+	}
+
+	if config.Templates != "" {
+		if templates, err := probe.Load(config.Templates); err != nil {
+			return nil, err
+		} else {
+			probes = append(probes, templates...)
+		}
+	}
+
+	for _, p := range probes {
+		if err := p.Compile(global); err != nil {
+			return nil, err
+		}
+	}
+
+	return probes, nil
+}
+
+// NewResolver returns a resolver for the servers, plain queries use the
+// network stack when raw dns is enabled.
+func (a *Scanner) NewResolver(servers []string) (*resolver.DNSResolver, error) {
+	var r *resolver.DNSResolver
+
+	if a.config.RawDNS {
+		if v, err := resolver.NewStack(a.s, servers, a.config.ResolverQPS); err != nil {
+			return nil, err
+		} else {
+			r = v
+		}
+	} else if v, err := resolver.New(servers, a.config.ResolverQPS); err != nil {
+		return nil, err
+	} else {
+		r = v
+	}
+
+	r.IPv6 = a.config.IPv6
+	return r, nil
+}
+
+// SetResolver sets the resolver, lookups are cached when the dns cache is
+// enabled.
+func (a *Scanner) SetResolver(r resolver.Resolver) {
+	a.pool = nil
+	if v, ok := r.(*resolver.DNSResolver); ok {
+		a.pool = v.Pool
+	}
+
+	if a.config.DNSCacheSize <= 0 {
+		a.resolver = r
+		return
+	}
+
+	a.cache = resolver.NewCache(r, a.config.DNSCacheSize, time.Duration(a.config.DNSNegativeTTL)*time.Second)
+	a.cache.MinTTL = time.Duration(a.config.DNSMinTTL) * time.Second
+	a.cache.MaxTTL = time.Duration(a.config.DNSMaxTTL) * time.Second
+	a.resolver = a.cache
+}
+
+func (a *Scanner) SetWriter(writer ResultWriter) {
+	a.writer = writer
 }
 
 func (a *Scanner) resolve(ctx context.Context) {
@@ -73,51 +277,200 @@ func (a *Scanner) resolve(ctx context.Context) {
 
 	var wg sync.WaitGroup
 
-	for host := range a.hostsCh {
+	line := -1
+
+	dispatch := func(line int, h string) {
 		q <- struct{}{}
 		wg.Add(1)
 
-		go func(h string) {
+		a.checkpoint.acquire(line)
+
+		go func(line int, h string) {
 			defer func() {
+				a.checkpoint.release(line)
+
 				wg.Done()
 				<-q
 			}()
 
-			a.lookup(h)
-		}(host)
+			a.lookup(line, h)
+		}(line, h)
+	}
+
+	// lines are buffered and picked at random when randomizing, so
+	// consecutive lookups go to different networks
+	type entry struct {
+		line int
+		host string
+	}
+
+	buffer := []entry{}
+
+	size := 0
+	if a.config.Randomize {
+		size = a.config.ShuffleBuffer
+	}
+
+loop:
+	for {
+		var host string
+
+		select {
+		case <-ctx.Done():
+			break loop
+		case v, ok := <-a.hostsCh:
+			if !ok {
+				break loop
+			}
+
+			host = v
+		}
+
+		line++
+
+		if a.checkpoint.Completed(line) {
+			continue
+		}
+
+		if size <= 1 {
+			dispatch(line, host)
+			continue
+		}
+
+		buffer = append(buffer, entry{line, host})
+		if len(buffer) < size {
+			continue
+		}
+
+		i := rand.Intn(len(buffer))
+		dispatch(buffer[i].line, buffer[i].host)
+
+		buffer[i] = buffer[len(buffer)-1]
+		buffer = buffer[:len(buffer)-1]
+	}
+
+	if ctx.Err() == nil {
+		rand.Shuffle(len(buffer), func(i, j int) {
+			buffer[i], buffer[j] = buffer[j], buffer[i]
+		})
+
+		for _, e := range buffer {
+			dispatch(e.line, e.host)
+		}
 	}
 
 	wg.Wait()
 }
 
-func (a *Scanner) lookup(h string) {
-	prefixes := strings.Split(a.config.Prefix, ",")
-	prefixes = append([]string{""}, prefixes...)
+func (a *Scanner) lookup(line int, h string) {
+	host := Host{
+		TLS:  a.config.UseTLS,
+		Port: a.config.Port,
+		line: line,
+	}
 
-	for _, prefix := range prefixes {
-		host := h
-		if prefix != "" {
-			host = strings.Join([]string{prefix, h}, ".")
+	if strings.Contains(h, "://") {
+		if err := parseURL(h, &host); err != nil {
+			color.Red("Invalid url (%s): %s", h, err.Error())
+		} else if !a.shard.contains(host.Name) {
+		} else if ip := net.ParseIP(host.Name); ip != nil {
+			host.IP = normalizeIP(ip)
+			a.send(host)
+		} else {
+			// urls describe a single host, prefixes don't apply
+			a.resolveHost(host, nil)
 		}
 
-		if ips, err := a.resolver.LookupHost(host); err != nil {
-			color.Red("Could not resolve host (%s): %s", host, err.Error())
-		} else if len(ips) == 0 {
+		return
+	}
+
+	if r, err := parseRange(h); err != nil {
+		color.Red("Invalid address range (%s): %s", h, err.Error())
+		return
+	} else if r != nil {
+		a.expand(host, r)
+		return
+	}
+
+	// prefixed names stay within the shard of the domain
+	if !a.shard.contains(h) {
+		return
+	}
+
+	a.lookupPrefixes(host, h)
+}
+
+// resolveHost resolves the name of host and sends a host per address. Names
+// resolving to the wildcard addresses of their domain are sent once.
+func (a *Scanner) resolveHost(host Host, w *wildcard) {
+	if a.exclude.MatchName(host.Name) {
+		atomic.AddUint64(&a.excludedNames, 1)
+		return
+	}
+
+	if a.names != nil && a.names.Add(host.target()) {
+		atomic.AddUint64(&a.duplicateNames, 1)
+		return
+	}
+
+	answer, err := a.resolver.Lookup(host.Name)
+	if answer != nil {
+		host.CNAMEs = answer.CNAMEs
+	}
+
+	if err == resolver.ErrNXDomain && a.dangling(host) {
+	} else if err != nil {
+		color.Red("Could not resolve host (%s): %s", host.Name, err.Error())
+	} else {
+		if len(answer.Addresses) == 0 {
+		} else if host.Prefix == "" {
+		} else if derived, collapse := w.collapse(answer.Addresses); collapse {
+			atomic.AddUint64(&a.wildcardCollapsed, 1)
+			return
 		} else {
-			for _, dest := range ips {
-				a.resolvedHostsCh <- Host{
-					Name: host,
-					IP:   dest,
-				}
-			}
+			host.Wildcard = derived
+		}
+
+		if len(answer.Addresses) > 0 {
+			a.prefixResolved(host)
 		}
+
+		for _, dest := range answer.Addresses {
+			host.IP = dest
+			a.send(host)
+		}
+	}
+}
+
+// send queues the host to be scanned, unless it is excluded or has been
+// sent before.
+func (a *Scanner) send(host Host) {
+	if a.exclude.MatchName(host.Name) {
+		atomic.AddUint64(&a.excludedNames, 1)
+		return
+	} else if a.exclude.MatchIP(host.IP) {
+		atomic.AddUint64(&a.excludedAddresses, 1)
+		return
+	}
+
+	if a.targets != nil && a.targets.Add(host.IP.String()+"|"+host.target()) {
+		atomic.AddUint64(&a.duplicateTargets, 1)
+		return
 	}
+
+	a.checkpoint.acquire(host.line)
+
+	a.resolvedHostsCh <- host
 }
 
 func (a *Scanner) connect(h Host) (net.Conn, error) {
-	if conn, err := a.s.Connect(h.IP, a.config.Port); err != nil {
-		return nil, err
-	} else if !a.config.UseTLS {
+	if h.IP.To4() == nil && !a.s.IPv6() {
+		return nil, &scanError{ErrorConnect, netstack.ErrNoIPv6}
+	}
+
+	if conn, err := a.s.Connect(h.IP, h.Port); err != nil {
+		return nil, &scanError{ErrorConnect, err}
+	} else if !h.TLS {
 		return conn, nil
 	} else {
 		tlsconn := tls.Client(conn, &tls.Config{
@@ -126,41 +479,162 @@ func (a *Scanner) connect(h Host) (net.Conn, error) {
 		})
 
 		if err := tlsconn.Handshake(); err != nil {
-			return nil, err
+			return nil, &scanError{ErrorTLS, err}
 		}
 
 		return tlsconn, nil
 	}
 }
 
-func (a *Scanner) scan(host Host) {
-	conn, err := a.connect(host)
+func (a *Scanner) newResult(host Host, p *probe.Probe) *Result {
+	r := &Result{
+		Host:     host.Name,
+		IP:       host.IP,
+		Port:     host.Port,
+		TLS:      host.TLS,
+		CNAMEs:   host.CNAMEs,
+		Wildcard: host.Wildcard,
+		Time:     time.Now(),
+	}
+
+	if p != nil {
+		r.Probe = p.ID
+		r.Severity = p.Severity
+		r.Method = p.Method
+		r.Path = host.path(p.Path)
+	}
+
+	return r
+}
+
+func (a *Scanner) emit(r *Result) {
+	if err := a.writer.Write(r); err != nil {
+		color.Red("Could not write result for %s: %s", r.Host, err.Error())
+	}
+}
+
+// request sends the request of the probe and reads the response into r. It
+// returns whether the server closes the connection after the response.
+func (a *Scanner) request(conn net.Conn, rd *bufio.Reader, host Host, p *probe.Probe, r *Result) (bool, error) {
+	defer func() {
+		r.Duration = time.Now().Sub(r.Time)
+	}()
+
+	payload := p.Request(host.header(), r.Path, a.config.UserAgent)
+	if _, err := conn.Write(payload); err != nil {
+		return false, &scanError{ErrorWrite, err}
+	}
+
+	resp, err := http.ReadResponse(rd, &http.Request{Method: p.Method})
+	if err != nil {
+		return false, &scanError{ErrorRead, err}
+	}
+
+	defer resp.Body.Close()
+
+	r.Status = resp.StatusCode
+	r.Header = resp.Header
+
+	data, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		color.Red("[%s]: Connect failed (%s): %s", host.Name, host.IP.String(), err.Error())
+		return false, &scanError{ErrorBody, err}
+	}
+
+	sum := sha256.Sum256(data)
+
+	r.Body = data
+	r.BodyLength = len(data)
+	r.BodyHash = hex.EncodeToString(sum[:])
+	return resp.Close, nil
+}
+
+func (a *Scanner) scan(host Host) {
+	s := &session{
+		a:    a,
+		host: host,
+	}
+
+	if err := s.open(); err != nil {
+		r := a.newResult(host, nil)
+		r.setError(err)
+		a.emit(r)
 		return
 	}
 
-	defer conn.Close()
+	defer s.close()
 
-	for _, path := range a.config.Paths {
-		payload := []byte(fmt.Sprintf("GET %s HTTP/1.1\r\nUser-Agent: %s\r\nHost: %s\r\nAccept: */*\r\n\r\n", path, a.config.UserAgent, host.Name))
-		if _, err := conn.Write([]byte(payload)); err != nil {
-			color.Red("Connection write %s: %s", host, err.Error())
-			break
-		}
+	if err := a.checkTakeover(s, host); err != nil {
+		r := a.newResult(host, nil)
+		r.setError(err)
+		a.emit(r)
+		return
+	}
+
+	// baselines per method, requested for the first match
+	baselines := map[string][]fingerprint{}
 
-		r := io.TeeReader(conn, ioutil.Discard)
-		if resp, err := http.ReadResponse(bufio.NewReader(r), nil); err != nil {
-			color.Red("Read response %s: %s", host, err.Error())
+	f := &fetcher{
+		a:    a,
+		s:    s,
+		host: host,
+	}
+
+	verified := map[string]bool{}
+
+	for _, p := range a.probes {
+		r := a.newResult(host, p)
+		if err := s.request(p, r); err != nil {
+			r.setError(err)
+			a.emit(r)
 			return
-		} else if data, err := ioutil.ReadAll(resp.Body); err != nil {
-			// ignore error
-			color.Red("ReadAll %s: %s", host, err.Error())
+		}
+
+		resp := &matcher.Response{
+			StatusCode: r.Status,
+			Header:     r.Header,
+			Body:       r.Body,
+		}
+
+		if !p.Match(resp) {
+			continue
+		}
+
+		fingerprints, ok := baselines[p.Method]
+		if !ok && a.config.Baseline > 0 {
+			fingerprints = a.baseline(s, host, p.Method)
+			baselines[p.Method] = fingerprints
+		}
+
+		if isBaseline(fingerprints, p.Method, resp) {
+			continue
+		}
+
+		a.prefixHit(host)
+
+		r.Extracted = p.Extract(resp)
+
+		// extracted values are reported as is, secrets in them are redacted
+		for name, value := range r.Extracted {
+			r.Extracted[name] = secrets.RedactAll(value)
+		}
+
+		if a.config.DetectSecrets || p.Secrets {
+			r.Secrets = a.detector.Detect(r.Body)
+		}
+
+		if err := a.verify(f, verified, p.Path, r); err != nil {
+			a.emit(r)
 			return
-		} else {
-			str := string(data[0:20])
-			color.Yellow("Got statuscode %d for host %s(%s) on path %s: %s.", resp.StatusCode, host.Name, host.IP.String(), path, str)
 		}
+
+		a.emit(r)
+	}
+}
+
+// reportResolvers prints the health of the resolvers.
+func (a *Scanner) reportResolvers() {
+	for _, stat := range a.pool.Stats() {
+		color.Yellow("Resolver %s: %d queries, %d timeouts, %d servfail, %d refused, %d errors, avg latency %v, ejected %d times.", stat.Name, stat.Queries, stat.Timeouts, stat.ServFails, stat.Refused, stat.Errors, stat.Latency.Round(time.Millisecond), stat.Ejections)
 	}
 }
 
@@ -181,13 +655,70 @@ func (a *Scanner) Scan(ctx context.Context) {
 
 	var wg sync.WaitGroup
 
+	if n := a.checkpoint.Count(); n > 0 {
+		color.Yellow("Resuming scan, skipping %d completed lines.", n)
+	}
+
+	if a.shard != nil {
+		color.Yellow("Scanning shard %d of %d.", a.shard.N, a.shard.M)
+	}
+
+	if n := a.exclude.Len(); n > 0 {
+		color.Yellow("Excluding %d domains and networks.", n)
+
+		defer func() {
+			color.Yellow("Excluded %d names and %d addresses.", atomic.LoadUint64(&a.excludedNames), atomic.LoadUint64(&a.excludedAddresses))
+		}()
+	}
+
+	if len(a.prefixes) > 1 {
+		defer a.reportPrefixes()
+
+		defer func() {
+			if n := atomic.LoadUint64(&a.wildcardDomains); n > 0 {
+				color.Yellow("Detected wildcard dns for %d domains, skipped %d names resolving to wildcard addresses.", n, atomic.LoadUint64(&a.wildcardCollapsed))
+			}
+		}()
+	}
+
+	if a.pool != nil {
+		defer a.reportResolvers()
+	}
+
+	if a.names != nil {
+		defer func() {
+			color.Yellow("Skipped %d duplicate names and %d duplicate targets.", atomic.LoadUint64(&a.duplicateNames), atomic.LoadUint64(&a.duplicateTargets))
+		}()
+	}
+
+	defer a.saveCheckpoint()
+
+	done := make(chan struct{})
+	defer close(done)
+
 	go func() {
-		<-ctx.Done()
-		if ctx.Err() == context.Canceled {
-			close(a.hostsCh)
+		ticker := time.NewTicker(10 * time.Second)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				a.saveCheckpoint()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+			return
+		}
 
+		if ctx.Err() == context.Canceled {
 			color.Yellow("Waiting for scans to finish.")
-			wg.Wait()
 		}
 	}()
 
@@ -196,7 +727,12 @@ func (a *Scanner) Scan(ctx context.Context) {
 		if count == 0 {
 		} else if count%100 == 0 {
 			ms := int(time.Now().Sub(start) / time.Millisecond)
-			color.Yellow("Checked %d hosts in %vs, avg=%vms per domain.\n", count, ms/1000, ms/count)
+
+			if hits, misses := a.cache.Stats(); hits+misses > 0 {
+				color.Yellow("Checked %d hosts in %vs, avg=%vms per domain, dns cache hit rate %.1f%% (%d hits, %d misses).\n", count, ms/1000, ms/count, float64(hits)*100/float64(hits+misses), hits, misses)
+			} else {
+				color.Yellow("Checked %d hosts in %vs, avg=%vms per domain.\n", count, ms/1000, ms/count)
+			}
 		}
 
 		ch <- struct{}{}
@@ -204,6 +740,8 @@ func (a *Scanner) Scan(ctx context.Context) {
 
 		go func(host Host) {
 			defer func() {
+				a.checkpoint.release(host.line)
+
 				<-ch
 				wg.Done()
 			}()
@@ -217,6 +755,20 @@ func (a *Scanner) Scan(ctx context.Context) {
 	wg.Wait()
 }
 
+// saveCheckpoint flushes the results and saves the checkpoint. Lines are
+// only marked as completed once their results have been written.
+func (a *Scanner) saveCheckpoint() {
+	if a.checkpoint == nil {
+		return
+	}
+
+	if err := a.writer.Flush(); err != nil {
+		color.Red("Could not flush results, not saving state file: %s", err.Error())
+	} else if err := a.checkpoint.Save(); err != nil {
+		color.Red("Could not save state file: %s", err.Error())
+	}
+}
+
 func (a *Scanner) Feed() chan string {
 	return a.hostsCh
 }
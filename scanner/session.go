@@ -0,0 +1,76 @@
+package scanner
+
+import (
+	"bufio"
+	"net"
+
+	"github.com/dutchcoders/anam/probe"
+)
+
+// session sends the requests of a scan over a keep-alive connection. The
+// connection is reopened when the server closes it.
+type session struct {
+	a    *Scanner
+	host Host
+
+	conn net.Conn
+	rd   *bufio.Reader
+
+	// requests sent over the current connection
+	requests int
+}
+
+func (s *session) open() error {
+	if s.conn != nil {
+		return nil
+	}
+
+	conn, err := s.a.connect(s.host)
+	if err != nil {
+		return err
+	}
+
+	s.conn = conn
+	s.rd = bufio.NewReader(conn)
+	s.requests = 0
+	return nil
+}
+
+func (s *session) close() {
+	if s.conn == nil {
+		return
+	}
+
+	s.conn.Close()
+	s.conn = nil
+	s.rd = nil
+}
+
+// request sends the request of the probe. Servers may close idle keep-alive
+// connections without notice, requests failing on a reused connection are
+// retried once on a new connection.
+func (s *session) request(p *probe.Probe, r *Result) error {
+	for {
+		if err := s.open(); err != nil {
+			return err
+		}
+
+		reused := s.requests > 0
+		s.requests++
+
+		closed, err := s.a.request(s.conn, s.rd, s.host, p, r)
+		if err == nil {
+			if closed {
+				s.close()
+			}
+
+			return nil
+		}
+
+		s.close()
+
+		if se, ok := err.(*scanError); !reused || !ok || (se.Class != ErrorWrite && se.Class != ErrorRead) {
+			return err
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package scanner
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+)
+
+// shard selects the hosts for one of the machines sharing the same input.
+// Hosts are assigned by the hash of their normalized name, so no
+// coordination between the machines is needed.
+type shard struct {
+	// N is 1-based
+	N, M uint64
+}
+
+// parseShard parses N/M, an empty string returns nil and selects all
+// hosts.
+func parseShard(s string) (*shard, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	parts := strings.Split(s, "/")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("Invalid shard %s, expected N/M.", s)
+	}
+
+	n, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid shard %s, expected N/M.", s)
+	}
+
+	m, err := strconv.ParseUint(parts[1], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid shard %s, expected N/M.", s)
+	}
+
+	sh := shard{N: n, M: m}
+	if sh.M == 0 || sh.N == 0 || sh.N > sh.M {
+		return nil, fmt.Errorf("Invalid shard %s, N should be between 1 and M.", s)
+	}
+
+	return &sh, nil
+}
+
+// contains returns whether the host belongs to the shard.
+func (s *shard) contains(name string) bool {
+	if s == nil {
+		return true
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(strings.TrimSuffix(strings.ToLower(name), ".")))
+	return h.Sum64()%s.M == s.N-1
+}
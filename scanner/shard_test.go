@@ -0,0 +1,101 @@
+package scanner
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParseShard(t *testing.T) {
+	for _, c := range []struct {
+		s    string
+		n, m uint64
+		err  bool
+	}{
+		{"1/1", 1, 1, false},
+		{"1/4", 1, 4, false},
+		{"4/4", 4, 4, false},
+		{"0/4", 0, 0, true},
+		{"5/4", 0, 0, true},
+		{"1/0", 0, 0, true},
+		{"0/0", 0, 0, true},
+		{"-1/4", 0, 0, true},
+		{"1/4x", 0, 0, true},
+		{"1/4/8", 0, 0, true},
+		{" 1/4", 0, 0, true},
+		{"1", 0, 0, true},
+		{"/", 0, 0, true},
+		{"a/b", 0, 0, true},
+	} {
+		sh, err := parseShard(c.s)
+		if c.err {
+			if err == nil {
+				t.Errorf("parseShard(%q) should fail", c.s)
+			}
+		} else if err != nil {
+			t.Errorf("parseShard(%q): %s", c.s, err)
+		} else if sh.N != c.n || sh.M != c.m {
+			t.Errorf("parseShard(%q) is %d/%d, should be %d/%d", c.s, sh.N, sh.M, c.n, c.m)
+		}
+	}
+
+	if sh, err := parseShard(""); err != nil || sh != nil {
+		t.Errorf("parseShard(\"\") is %v %v, should select all hosts", sh, err)
+	}
+}
+
+func TestShardContains(t *testing.T) {
+	var all *shard
+	if !all.contains("example.com") {
+		t.Error("without shard every host should be contained")
+	}
+
+	sh := &shard{N: 2, M: 3}
+
+	// the name is normalized
+	for _, name := range []string{"Example.COM", "example.com.", "EXAMPLE.COM."} {
+		if sh.contains(name) != sh.contains("example.com") {
+			t.Errorf("%s should be in the same shard as example.com", name)
+		}
+	}
+}
+
+func TestShardCover(t *testing.T) {
+	const hosts = 10000
+
+	for _, m := range []uint64{1, 2, 3, 7, 16} {
+		shards := []*shard{}
+		for n := uint64(1); n <= m; n++ {
+			sh, err := parseShard(fmt.Sprintf("%d/%d", n, m))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			shards = append(shards, sh)
+		}
+
+		counts := make([]int, m)
+
+		for i := 0; i < hosts; i++ {
+			name := fmt.Sprintf("host%d.example.com", i)
+
+			found := 0
+			for j, sh := range shards {
+				if sh.contains(name) {
+					counts[j]++
+					found++
+				}
+			}
+
+			if found != 1 {
+				t.Fatalf("m=%d: %s is in %d shards, should be in exactly one", m, name, found)
+			}
+		}
+
+		// the hosts are spread evenly
+		for j, count := range counts {
+			if expected := hosts / int(m); count < expected*8/10 || count > expected*12/10 {
+				t.Errorf("m=%d: shard %d has %d hosts, expected about %d", m, j+1, count, expected)
+			}
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package scanner
+
+import (
+	"strings"
+
+	"github.com/dutchcoders/anam/matcher"
+	"github.com/dutchcoders/anam/probe"
+	"github.com/dutchcoders/anam/takeover"
+	"github.com/dutchcoders/anam/verify"
+)
+
+const takeoverProbe = "takeover"
+
+func (a *Scanner) takeoverResult(host Host, f *takeover.Fingerprint, cname, reason string) *Result {
+	r := a.newResult(host, nil)
+	r.Probe = takeoverProbe
+	r.Severity = "high"
+	r.Findings = []*verify.Finding{{
+		Module:   takeoverProbe,
+		Verified: true,
+		Details: map[string]interface{}{
+			"service": f.Service,
+			"cname":   cname,
+			"reason":  reason,
+		},
+	}}
+
+	return r
+}
+
+// dangling reports hosts with a canonical name of a service that doesn't
+// exist, these can be claimed by registering the name at the service.
+func (a *Scanner) dangling(host Host) bool {
+	f, cname := takeover.Match(a.fingerprints, host.CNAMEs)
+	if f == nil || !f.NXDomain {
+		return false
+	}
+
+	a.emit(a.takeoverResult(host, f, cname, "nxdomain"))
+	return true
+}
+
+// checkTakeover requests the root of hosts pointing to a service, and
+// reports the host when the response is the one of unclaimed resources.
+// Every name and cname is checked once, over the first address that
+// responds.
+func (a *Scanner) checkTakeover(s *session, host Host) error {
+	f, cname := takeover.Match(a.fingerprints, host.CNAMEs)
+	if f == nil || len(f.Body) == 0 {
+		return nil
+	}
+
+	key := strings.ToLower(host.Name) + " " + strings.ToLower(cname)
+	if _, checked := a.takeoverChecked.LoadOrStore(key, true); checked {
+		return nil
+	}
+
+	p := probe.FromPath("/", matcher.Spec{})
+
+	r := a.takeoverResult(host, f, cname, "body")
+	r.Method = p.Method
+	r.Path = host.path(p.Path)
+
+	if err := s.request(p, r); err != nil {
+		// another address can be checked
+		a.takeoverChecked.Delete(key)
+		return err
+	}
+
+	if f.MatchBody(r.Body) {
+		a.emit(r)
+	}
+
+	return nil
+}
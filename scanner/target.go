@@ -0,0 +1,188 @@
+package scanner
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// largest range that will be expanded
+const maxRangeSize = 1 << 32
+
+// ipRange is a range of consecutive addresses, as given by a bare IP, a
+// CIDR or a first-last range on an input line.
+type ipRange struct {
+	first net.IP
+	size  uint64
+}
+
+// at returns the i-th address of the range.
+func (r *ipRange) at(i uint64) net.IP {
+	ip := make(net.IP, len(r.first))
+	copy(ip, r.first)
+
+	carry := i
+	for j := len(ip) - 1; j >= 0 && carry > 0; j-- {
+		sum := uint64(ip[j]) + carry&0xff
+		ip[j] = byte(sum)
+
+		carry = carry>>8 + sum>>8
+	}
+
+	return ip
+}
+
+// parseRange parses the input line as an address range. It returns nil
+// when the line is not an address, range or CIDR.
+func parseRange(line string) (*ipRange, error) {
+	if ip := net.ParseIP(line); ip != nil {
+		return &ipRange{first: normalizeIP(ip), size: 1}, nil
+	}
+
+	if strings.Contains(line, "/") {
+		_, network, err := net.ParseCIDR(line)
+		if err != nil {
+			return nil, err
+		}
+
+		ones, bits := network.Mask.Size()
+		if bits-ones > 32 {
+			return nil, fmt.Errorf("Network %s is too large.", line)
+		}
+
+		return &ipRange{first: normalizeIP(network.IP), size: 1 << uint(bits-ones)}, nil
+	}
+
+	parts := strings.SplitN(line, "-", 2)
+	if len(parts) != 2 {
+		return nil, nil
+	}
+
+	first, last := net.ParseIP(strings.TrimSpace(parts[0])), net.ParseIP(strings.TrimSpace(parts[1]))
+	if first == nil || last == nil {
+		// domain names can contain dashes as well
+		return nil, nil
+	}
+
+	first, last = normalizeIP(first), normalizeIP(last)
+	if len(first) != len(last) {
+		return nil, fmt.Errorf("Range %s mixes address families.", line)
+	}
+
+	size := new(big.Int).Sub(new(big.Int).SetBytes(last), new(big.Int).SetBytes(first))
+	if size.Sign() < 0 {
+		return nil, fmt.Errorf("Range %s is reversed.", line)
+	}
+
+	size.Add(size, big.NewInt(1))
+	if size.Cmp(big.NewInt(maxRangeSize)) > 0 {
+		return nil, fmt.Errorf("Range %s is too large.", line)
+	}
+
+	return &ipRange{first: first, size: size.Uint64()}, nil
+}
+
+func normalizeIP(ip net.IP) net.IP {
+	if v4 := ip.To4(); v4 != nil {
+		return v4
+	}
+
+	return ip
+}
+
+// expand feeds every address of the range as a host, named by its reverse
+// dns name when enabled. The addresses are permuted when randomizing.
+func (a *Scanner) expand(host Host, r *ipRange) {
+	var pm *permutation
+	if a.config.Randomize {
+		pm = newPermutation(r.size)
+	}
+
+	for i := uint64(0); i < r.size; i++ {
+		j := i
+		if pm == nil {
+		} else if k, ok := pm.next(); !ok {
+			break
+		} else {
+			j = k
+		}
+
+		host.IP = r.at(j)
+
+		// ranges are spread over the shards by address
+		if !a.shard.contains(host.IP.String()) {
+			continue
+		}
+
+		host.Name = host.IP.String()
+		if !a.config.ReverseDNS {
+		} else if ptr, err := a.resolver.LookupAddr(host.IP); err != nil {
+		} else if ptr != "" {
+			host.Name = ptr
+		}
+
+		a.send(host)
+	}
+}
+
+// parseURL sets the name, scheme, port and base path of host from an url
+// input line.
+func parseURL(line string, host *Host) error {
+	u, err := url.Parse(line)
+	if err != nil {
+		return err
+	}
+
+	switch u.Scheme {
+	case "http":
+		host.TLS, host.Port = false, 80
+	case "https":
+		host.TLS, host.Port = true, 443
+	default:
+		return fmt.Errorf("Unsupported scheme %s.", u.Scheme)
+	}
+
+	if u.Hostname() == "" {
+		return errors.New("Url has no host.")
+	}
+
+	if v := u.Port(); v == "" {
+	} else if port, err := strconv.Atoi(v); err != nil || port <= 0 || port > 65535 {
+		return fmt.Errorf("Invalid port %s.", v)
+	} else {
+		host.Port = port
+	}
+
+	host.Name = u.Hostname()
+	host.Path = u.EscapedPath()
+	return nil
+}
+
+// target identifies what is requested from a host, regardless of its
+// address: the normalized name, the scheme, the port and the base path.
+func (h Host) target() string {
+	name := strings.TrimSuffix(strings.ToLower(h.Name), ".")
+	return fmt.Sprintf("%s|%t|%d|%s", name, h.TLS, h.Port, h.Path)
+}
+
+// path returns the path of a probe relative to the base path of the host.
+func (h Host) path(p string) string {
+	return strings.TrimSuffix(h.Path, "/") + p
+}
+
+// header returns the value of the Host header, the port is only included
+// when it isn't the default for the scheme.
+func (h Host) header() string {
+	if (h.TLS && h.Port != 443) || (!h.TLS && h.Port != 80) {
+		return net.JoinHostPort(h.Name, strconv.Itoa(h.Port))
+	} else if strings.Contains(h.Name, ":") {
+		// ipv6 literal
+		return "[" + h.Name + "]"
+	}
+
+	return h.Name
+}
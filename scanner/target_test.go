@@ -0,0 +1,199 @@
+package scanner
+
+import (
+	"net"
+	"testing"
+)
+
+func TestParseRange(t *testing.T) {
+	for _, c := range []struct {
+		line  string
+		first string
+		size  uint64
+		err   bool
+	}{
+		{"192.0.2.1", "192.0.2.1", 1, false},
+		{"::ffff:192.0.2.1", "192.0.2.1", 1, false},
+		{"2001:db8::1", "2001:db8::1", 1, false},
+		{"192.0.2.0/24", "192.0.2.0", 256, false},
+		{"192.0.2.77/30", "192.0.2.76", 4, false},
+		{"10.0.0.0/0", "0.0.0.0", 1 << 32, false},
+		{"2001:db8::/120", "2001:db8::", 256, false},
+		{"2001:db8::/64", "", 0, true},
+		{"192.0.2.0/33", "", 0, true},
+		{"192.0.2.250-192.0.3.5", "192.0.2.250", 12, false},
+		{"192.0.2.1 - 192.0.2.1", "192.0.2.1", 1, false},
+		{"2001:db8::ff-2001:db8::100", "2001:db8::ff", 2, false},
+		{"192.0.2.5-192.0.2.1", "", 0, true},
+		{"192.0.2.1-2001:db8::1", "", 0, true},
+		{"::-::1:0:0", "", 0, true},
+		// not an address, the line is a host name
+		{"example.com", "", 0, false},
+		{"my-host.example.com", "", 0, false},
+		{"192.0.2.1-example", "", 0, false},
+		{"", "", 0, false},
+	} {
+		r, err := parseRange(c.line)
+		if c.err {
+			if err == nil {
+				t.Errorf("parseRange(%q) should fail", c.line)
+			}
+
+			continue
+		} else if err != nil {
+			t.Errorf("parseRange(%q): %s", c.line, err)
+			continue
+		}
+
+		if c.first == "" {
+			if r != nil {
+				t.Errorf("parseRange(%q) should not be a range", c.line)
+			}
+
+			continue
+		}
+
+		if r == nil {
+			t.Errorf("parseRange(%q) should be a range", c.line)
+		} else if !r.first.Equal(net.ParseIP(c.first)) || r.size != c.size {
+			t.Errorf("parseRange(%q) is %s+%d, should be %s+%d", c.line, r.first, r.size, c.first, c.size)
+		}
+	}
+}
+
+func TestRangeAt(t *testing.T) {
+	for _, c := range []struct {
+		first string
+		i     uint64
+		ip    string
+	}{
+		{"192.0.2.0", 0, "192.0.2.0"},
+		{"192.0.2.0", 255, "192.0.2.255"},
+		{"192.0.2.255", 1, "192.0.3.0"},
+		{"192.0.255.255", 1, "192.1.0.0"},
+		{"0.0.0.0", 1<<32 - 1, "255.255.255.255"},
+		{"10.0.0.1", 0x01020304, "11.2.3.5"},
+		{"2001:db8::ffff", 1, "2001:db8::1:0"},
+		{"2001:db8::ffff:ffff", 1, "2001:db8::1:0:0"},
+	} {
+		r := &ipRange{first: normalizeIP(net.ParseIP(c.first))}
+		if ip := r.at(c.i); !ip.Equal(net.ParseIP(c.ip)) {
+			t.Errorf("%s + %d is %s, should be %s", c.first, c.i, ip, c.ip)
+		}
+	}
+
+	// the first address isn't modified
+	r := &ipRange{first: net.ParseIP("192.0.2.1").To4()}
+	r.at(1)
+
+	if !r.first.Equal(net.ParseIP("192.0.2.1")) {
+		t.Errorf("at modified the first address to %s", r.first)
+	}
+}
+
+func TestNormalizeIP(t *testing.T) {
+	for k, v := range map[string]int{
+		"192.0.2.1":        4,
+		"::ffff:192.0.2.1": 4,
+		"2001:db8::1":      16,
+		"::1":              16,
+	} {
+		if ip := normalizeIP(net.ParseIP(k)); len(ip) != v {
+			t.Errorf("normalizeIP(%s) has length %d, should be %d", k, len(ip), v)
+		} else if !ip.Equal(net.ParseIP(k)) {
+			t.Errorf("normalizeIP(%s) is %s", k, ip)
+		}
+	}
+}
+
+func TestParseURL(t *testing.T) {
+	for _, c := range []struct {
+		line string
+		host Host
+		err  bool
+	}{
+		{"http://example.com", Host{Name: "example.com", Port: 80}, false},
+		{"https://example.com/", Host{Name: "example.com", TLS: true, Port: 443, Path: "/"}, false},
+		{"https://example.com:8443/app/", Host{Name: "example.com", TLS: true, Port: 8443, Path: "/app/"}, false},
+		{"http://example.com/a%20b/c?q=1", Host{Name: "example.com", Port: 80, Path: "/a%20b/c"}, false},
+		{"http://[2001:db8::1]:8080/app", Host{Name: "2001:db8::1", Port: 8080, Path: "/app"}, false},
+		{"https://[2001:db8::1]", Host{Name: "2001:db8::1", TLS: true, Port: 443}, false},
+		{"http://192.0.2.1:8000", Host{Name: "192.0.2.1", Port: 8000}, false},
+		{"example.com", Host{}, true},
+		{"example.com:8080/app", Host{}, true},
+		{"ftp://example.com", Host{}, true},
+		{"http:///app", Host{}, true},
+		{"http://example.com:0", Host{}, true},
+		{"http://example.com:65536", Host{}, true},
+		{"http://example.com:port", Host{}, true},
+	} {
+		host := Host{}
+
+		err := parseURL(c.line, &host)
+		if c.err {
+			if err == nil {
+				t.Errorf("parseURL(%q) should fail", c.line)
+			}
+		} else if err != nil {
+			t.Errorf("parseURL(%q): %s", c.line, err)
+		} else if host.Name != c.host.Name || host.TLS != c.host.TLS || host.Port != c.host.Port || host.Path != c.host.Path {
+			t.Errorf("parseURL(%q) is %+v, should be %+v", c.line, host, c.host)
+		}
+	}
+}
+
+func TestHostHeader(t *testing.T) {
+	for _, c := range []struct {
+		host   Host
+		header string
+	}{
+		{Host{Name: "example.com", Port: 80}, "example.com"},
+		{Host{Name: "example.com", TLS: true, Port: 443}, "example.com"},
+		{Host{Name: "example.com", Port: 8080}, "example.com:8080"},
+		{Host{Name: "example.com", TLS: true, Port: 80}, "example.com:80"},
+		{Host{Name: "example.com", Port: 443}, "example.com:443"},
+		{Host{Name: "2001:db8::1", Port: 80}, "[2001:db8::1]"},
+		{Host{Name: "2001:db8::1", TLS: true, Port: 8443}, "[2001:db8::1]:8443"},
+		{Host{Name: "192.0.2.1", TLS: true, Port: 443}, "192.0.2.1"},
+	} {
+		if header := c.host.header(); header != c.header {
+			t.Errorf("header of %+v is %q, should be %q", c.host, header, c.header)
+		}
+	}
+}
+
+func TestHostTarget(t *testing.T) {
+	host := Host{Name: "example.com", TLS: true, Port: 443, Path: "/app/"}
+
+	// the address and case of the name don't matter
+	for _, v := range []Host{
+		{Name: "Example.COM.", TLS: true, Port: 443, Path: "/app/", IP: net.ParseIP("192.0.2.1")},
+		{Name: "example.com", TLS: true, Port: 443, Path: "/app/", IP: net.ParseIP("192.0.2.2")},
+	} {
+		if v.target() != host.target() {
+			t.Errorf("target of %+v is %q, should be %q", v, v.target(), host.target())
+		}
+	}
+
+	for _, v := range []Host{
+		{Name: "www.example.com", TLS: true, Port: 443, Path: "/app/"},
+		{Name: "example.com", TLS: false, Port: 443, Path: "/app/"},
+		{Name: "example.com", TLS: true, Port: 8443, Path: "/app/"},
+		{Name: "example.com", TLS: true, Port: 443, Path: "/"},
+	} {
+		if v.target() == host.target() {
+			t.Errorf("target of %+v should differ from %q", v, host.target())
+		}
+	}
+
+	for k, v := range map[string]string{
+		"":      "/.git/HEAD",
+		"/":     "/.git/HEAD",
+		"/app":  "/app/.git/HEAD",
+		"/app/": "/app/.git/HEAD",
+	} {
+		if p := (Host{Path: k}).path("/.git/HEAD"); p != v {
+			t.Errorf("path with base %q is %q, should be %q", k, p, v)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package scanner
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// wildcard is the address set a domain with wildcard dns resolves random
+// names to. Only the first prefixed name resolving to the same set is
+// scanned.
+type wildcard struct {
+	m sync.Mutex
+
+	key     string
+	claimed bool
+}
+
+func addressKey(ips []net.IP) string {
+	keys := make([]string, len(ips))
+	for i, ip := range ips {
+		keys[i] = ip.String()
+	}
+
+	sort.Strings(keys)
+	return strings.Join(keys, ",")
+}
+
+// detectWildcard resolves a random name under the domain, it returns nil
+// when the domain has no wildcard dns.
+func (a *Scanner) detectWildcard(domain string) *wildcard {
+	b := make([]byte, 8)
+	rand.Read(b)
+
+	// a wildcard exclusion covers the random name as well
+	name := hex.EncodeToString(b) + "." + domain
+	if a.exclude.MatchName(name) {
+		return nil
+	}
+
+	answer, err := a.resolver.Lookup(name)
+	if err != nil || len(answer.Addresses) == 0 {
+		return nil
+	}
+
+	atomic.AddUint64(&a.wildcardDomains, 1)
+
+	return &wildcard{
+		key: addressKey(answer.Addresses),
+	}
+}
+
+// collapse returns whether the addresses of a prefixed name are the
+// wildcard addresses of a domain already being scanned.
+func (w *wildcard) collapse(ips []net.IP) (derived bool, collapse bool) {
+	if w == nil || addressKey(ips) != w.key {
+		return false, false
+	}
+
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	if w.claimed {
+		return true, true
+	}
+
+	w.claimed = true
+	return true, false
+}
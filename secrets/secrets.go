@@ -0,0 +1,225 @@
+// Package secrets recognises credentials in response bodies. Only redacted
+// values and fingerprints of the secrets are reported, so results can be
+// stored without storing the secrets themselves.
+package secrets
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Rule recognises a single kind of secret. The secret is the submatch
+// Group of the expression, the full match is used as context.
+type Rule struct {
+	ID     string
+	Regexp *regexp.Regexp
+	Group  int
+
+	// MinEntropy is the minimal shannon entropy, in bits per character,
+	// of the secret.
+	MinEntropy float64
+
+	// redact returns the redacted form of the full match
+	redact func(match, secret string) string
+}
+
+// Secret is a credential found in a body.
+type Secret struct {
+	Rule        string `json:"rule"`
+	Redacted    string `json:"redacted"`
+	Fingerprint string `json:"fingerprint"`
+	Line        int    `json:"line"`
+}
+
+var Rules = []*Rule{
+	{
+		ID:     "private-key",
+		Regexp: regexp.MustCompile(`(?s)-----BEGIN ([A-Z ]*PRIVATE KEY(?: BLOCK)?)-----.+?-----END [A-Z ]*PRIVATE KEY(?: BLOCK)?-----`),
+		redact: func(match, secret string) string {
+			return strings.SplitN(match, "\n", 2)[0]
+		},
+	},
+	{
+		ID:     "aws-access-key-id",
+		Regexp: regexp.MustCompile(`\b((?:AKIA|ASIA)[0-9A-Z]{16})\b`),
+		Group:  1,
+	},
+	{
+		ID:     "aws-secret-access-key",
+		Regexp: regexp.MustCompile(`(?i)aws_?secret_?(?:access_?)?key["']?\s*[:=]\s*["']?([A-Za-z0-9/+=]{40})`),
+		Group:  1,
+	},
+	{
+		ID:     "database-url",
+		Regexp: regexp.MustCompile(`\b(?:postgres(?:ql)?|mysqli?|mariadb|mongodb(?:\+srv)?|redis|rediss|amqps?|mssql|sqlserver)://[^:@/\s"']+:([^@\s"']+)@[^\s"'<>]+`),
+		Group:  1,
+	},
+	{
+		ID:     "url-credentials",
+		Regexp: regexp.MustCompile(`\b[a-zA-Z][a-zA-Z0-9+.\-]*://[^:@/\s"']+:([^@/\s"']+)@[^\s"'<>]+`),
+		Group:  1,
+	},
+	{
+		ID:     "github-token",
+		Regexp: regexp.MustCompile(`\b((?:ghp|gho|ghu|ghs|ghr)_[A-Za-z0-9]{36})\b`),
+		Group:  1,
+	},
+	{
+		ID:     "slack-token",
+		Regexp: regexp.MustCompile(`\b(xox[abprs]-[A-Za-z0-9-]{10,})\b`),
+		Group:  1,
+	},
+	{
+		ID:     "google-api-key",
+		Regexp: regexp.MustCompile(`\b(AIza[0-9A-Za-z_\-]{35})\b`),
+		Group:  1,
+	},
+	{
+		ID:     "stripe-secret-key",
+		Regexp: regexp.MustCompile(`\b((?:sk|rk)_live_[0-9A-Za-z]{20,})\b`),
+		Group:  1,
+	},
+	{
+		ID:         "generic-secret",
+		Regexp:     regexp.MustCompile(`(?i)[a-z0-9_.\-]*(?:key|secret|token|passw(?:or)?d|pwd|auth|credential)[a-z0-9_.\-]*["']?\s*(?:=|:|=>)\s*["']?([^\s"'<>,;]{12,})`),
+		Group:      1,
+		MinEntropy: 3.5,
+	},
+}
+
+// Detector recognises secrets using the rules. Fingerprints are keyed
+// hashes, secrets with little entropy can't be recovered from them without
+// the key.
+type Detector struct {
+	key []byte
+}
+
+// New returns a detector fingerprinting secrets with key. Fingerprints are
+// comparable across scans using the same key.
+func New(key []byte) *Detector {
+	return &Detector{
+		key: key,
+	}
+}
+
+// Detect returns the secrets in data. A secret matched by multiple rules is
+// only reported once, for the first rule.
+func (d *Detector) Detect(data []byte) []Secret {
+	secrets := []Secret{}
+	seen := map[string]bool{}
+
+	for _, rule := range Rules {
+		for _, loc := range rule.Regexp.FindAllSubmatchIndex(data, -1) {
+			start, end := loc[2*rule.Group], loc[2*rule.Group+1]
+
+			secret := string(data[start:end])
+
+			if rule.MinEntropy > 0 && entropy(secret) < rule.MinEntropy {
+				continue
+			}
+
+			fingerprint := d.Fingerprint(secret)
+			if seen[fingerprint] {
+				continue
+			}
+
+			seen[fingerprint] = true
+
+			secrets = append(secrets, Secret{
+				Rule:        rule.ID,
+				Redacted:    rule.redacted(data, loc),
+				Fingerprint: fingerprint,
+				Line:        bytes.Count(data[:loc[0]], []byte{'\n'}) + 1,
+			})
+		}
+	}
+
+	sort.Slice(secrets, func(i, j int) bool {
+		return secrets[i].Line < secrets[j].Line
+	})
+
+	return secrets
+}
+
+// RedactAll returns s with the secrets recognised by the rules redacted, for
+// values like extracted fields that are reported as is.
+func RedactAll(s string) string {
+	data := []byte(s)
+
+	for _, rule := range Rules {
+		locs := rule.Regexp.FindAllSubmatchIndex(data, -1)
+		if len(locs) == 0 {
+			continue
+		}
+
+		redacted := []byte{}
+
+		prev := 0
+		for _, loc := range locs {
+			start, end := loc[2*rule.Group], loc[2*rule.Group+1]
+			if rule.MinEntropy > 0 && entropy(string(data[start:end])) < rule.MinEntropy {
+				continue
+			}
+
+			redacted = append(redacted, data[prev:loc[0]]...)
+			redacted = append(redacted, rule.redacted(data, loc)...)
+			prev = loc[1]
+		}
+
+		data = append(redacted, data[prev:]...)
+	}
+
+	return string(data)
+}
+
+// redacted returns the redacted form of the match at loc.
+func (rule *Rule) redacted(data []byte, loc []int) string {
+	start, end := loc[2*rule.Group], loc[2*rule.Group+1]
+
+	if rule.redact != nil {
+		return rule.redact(string(data[loc[0]:loc[1]]), string(data[start:end]))
+	}
+
+	return string(data[loc[0]:start]) + Redact(string(data[start:end])) + string(data[end:loc[1]])
+}
+
+// Redact masks all but the first four and last two characters of longer
+// secrets, shorter secrets are masked completely.
+func Redact(secret string) string {
+	if len(secret) < 16 {
+		return strings.Repeat("*", 8)
+	}
+
+	return secret[:4] + strings.Repeat("*", 8) + secret[len(secret)-2:]
+}
+
+// Fingerprint returns a truncated hmac-sha256 of the secret, to recognise
+// the same secret across hosts and scans.
+func (d *Detector) Fingerprint(secret string) string {
+	h := hmac.New(sha256.New, d.key)
+	h.Write([]byte(secret))
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
+
+func entropy(s string) float64 {
+	counts := map[rune]int{}
+	for _, r := range s {
+		counts[r]++
+	}
+
+	n := float64(len([]rune(s)))
+
+	e := 0.0
+	for _, c := range counts {
+		p := float64(c) / n
+		e -= p * math.Log2(p)
+	}
+
+	return e
+}
@@ -0,0 +1,80 @@
+// Package takeover detects dangling cnames, pointing to unclaimed resources
+// of hosting providers.
+package takeover
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Fingerprint describes how an unclaimed resource of a service looks like.
+type Fingerprint struct {
+	Service string `yaml:"service"`
+
+	// CNAMEs contains the domains of the service, canonical names ending
+	// with one of them belong to the service
+	CNAMEs []string `yaml:"cname"`
+
+	// NXDomain marks canonical names that don't exist as claimable
+	NXDomain bool `yaml:"nxdomain"`
+
+	// Body contains strings of the response of unclaimed resources
+	Body []string `yaml:"body"`
+}
+
+// Load returns the fingerprints of the yaml file.
+func Load(path string) ([]*Fingerprint, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	fingerprints := []*Fingerprint{}
+	if err := yaml.UnmarshalStrict(data, &fingerprints); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err.Error())
+	}
+
+	for _, f := range fingerprints {
+		if f.Service == "" || len(f.CNAMEs) == 0 {
+			return nil, fmt.Errorf("%s: fingerprints need a service and cnames", path)
+		}
+	}
+
+	return fingerprints, nil
+}
+
+// Match returns the fingerprint of the service the chain of canonical names
+// points to, together with the matching name.
+func Match(fingerprints []*Fingerprint, cnames []string) (*Fingerprint, string) {
+	for i := len(cnames) - 1; i >= 0; i-- {
+		name := strings.ToLower(strings.TrimSuffix(cnames[i], "."))
+
+		for _, f := range fingerprints {
+			for _, domain := range f.CNAMEs {
+				domain = strings.ToLower(strings.Trim(domain, "."))
+
+				if name == domain || strings.HasSuffix(name, "."+domain) {
+					return f, cnames[i]
+				}
+			}
+		}
+	}
+
+	return nil, ""
+}
+
+// MatchBody returns whether the body is the response of an unclaimed
+// resource.
+func (f *Fingerprint) MatchBody(body []byte) bool {
+	for _, s := range f.Body {
+		if bytes.Contains(body, []byte(s)) {
+			return true
+		}
+	}
+
+	return false
+}
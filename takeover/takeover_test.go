@@ -0,0 +1,82 @@
+package takeover
+
+import "testing"
+
+func load(t *testing.T) []*Fingerprint {
+	fingerprints, err := Load("../takeover.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return fingerprints
+}
+
+func TestMatch(t *testing.T) {
+	fingerprints := load(t)
+
+	for _, c := range []struct {
+		cnames  []string
+		service string
+		cname   string
+	}{
+		{[]string{"assets.example.com.", "example.s3.amazonaws.com."}, "aws-s3", "example.s3.amazonaws.com."},
+		{[]string{"EXAMPLE.GITHUB.IO."}, "github-pages", "EXAMPLE.GITHUB.IO."},
+		{[]string{"app.example.com", "example.herokuapp.com", "us-east-1-a.route.herokuapp.com"}, "heroku", "us-east-1-a.route.herokuapp.com"},
+		{[]string{"example.azurewebsites.net."}, "azure", "example.azurewebsites.net."},
+		// the domain itself, but not names merely ending with it
+		{[]string{"github.io."}, "github-pages", "github.io."},
+		{[]string{"notgithub.io."}, "", ""},
+		{[]string{"github.io.example.com."}, "", ""},
+		{nil, "", ""},
+	} {
+		f, cname := Match(fingerprints, c.cnames)
+
+		service := ""
+		if f != nil {
+			service = f.Service
+		}
+
+		if service != c.service || cname != c.cname {
+			t.Errorf("Match(%v) is %q %q, should be %q %q", c.cnames, service, cname, c.service, c.cname)
+		}
+	}
+}
+
+func TestMatchBody(t *testing.T) {
+	fingerprints := load(t)
+
+	service := func(name string) *Fingerprint {
+		for _, f := range fingerprints {
+			if f.Service == name {
+				return f
+			}
+		}
+
+		t.Fatalf("no fingerprint for %s", name)
+		return nil
+	}
+
+	for _, c := range []struct {
+		service  string
+		body     string
+		expected bool
+	}{
+		{"aws-s3", "<Error><Code>NoSuchBucket</Code><Message>The specified bucket does not exist</Message></Error>", true},
+		{"aws-s3", "<Error><Code>AccessDenied</Code></Error>", false},
+		{"github-pages", "<h1>404</h1><p>There isn't a GitHub Pages site here.</p>", true},
+		{"heroku", "<iframe src=\"//www.herokucdn.com/error-pages/no-such-app.html\"></iframe>", true},
+		{"fastly", "Fastly error: unknown domain: www.example.com.", true},
+		{"fastly", "fastly error: Unknown Domain", false},
+		{"azure", "anything", false},
+	} {
+		if service(c.service).MatchBody([]byte(c.body)) != c.expected {
+			t.Errorf("%s: MatchBody(%q) should be %v", c.service, c.body, c.expected)
+		}
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	if _, err := Load("takeover_test.go"); err == nil {
+		t.Error("loading a file that isn't yaml should fail")
+	}
+}
@@ -0,0 +1,408 @@
+// Package git verifies exposed .git directories, by fetching and parsing
+// the repository metadata and objects, and optionally reconstructs the
+// repository locally.
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/dutchcoders/anam/secrets"
+	"github.com/dutchcoders/anam/verify"
+)
+
+// amount of file names to include in a finding
+const maxFiles = 25
+
+var (
+	shaRegexp    = regexp.MustCompile(`^[0-9a-f]{40}$`)
+	remoteRegexp = regexp.MustCompile(`(?m)^\s*url\s*=\s*(\S+)`)
+)
+
+// Module verifies exposed .git directories. When Dir is set the fetched
+// repository is written to a directory per host.
+type Module struct {
+	Dir        string
+	MaxObjects int
+}
+
+func New(dir string, maxObjects int) *Module {
+	return &Module{
+		Dir:        dir,
+		MaxObjects: maxObjects,
+	}
+}
+
+func (m *Module) Name() string {
+	return "git"
+}
+
+func (m *Module) Applies(path string) bool {
+	return strings.HasPrefix(path, "/.git/")
+}
+
+type verification struct {
+	verify.Fetcher
+
+	// files contains the fetched files, relative to .git
+	files map[string][]byte
+
+	objects []*object
+
+	// worktree contains the blob per path, for reconstruction
+	worktree map[string]string
+}
+
+// fetch returns the file from the .git directory, or nil when it does not
+// exist.
+func (v *verification) fetch(name string) ([]byte, error) {
+	status, body, err := v.Fetch("/.git/" + name)
+	if err != nil {
+		return nil, err
+	} else if status != 200 {
+		return nil, nil
+	}
+
+	v.files[name] = body
+	return body, nil
+}
+
+func (v *verification) fetchObject(sha string) (*object, error) {
+	if !shaRegexp.MatchString(sha) {
+		return nil, fmt.Errorf("Invalid object name %s.", sha)
+	}
+
+	name := fmt.Sprintf("objects/%s/%s", sha[:2], sha[2:])
+
+	status, body, err := v.Fetch("/.git/" + name)
+	if err != nil {
+		return nil, err
+	} else if status != 200 {
+		return nil, nil
+	}
+
+	o, err := parseObject(sha, body)
+	if err != nil {
+		// not a valid object, most likely a soft-404
+		return nil, nil
+	}
+
+	v.objects = append(v.objects, o)
+	return o, nil
+}
+
+func (m *Module) Verify(host string, f verify.Fetcher) (*verify.Finding, error) {
+	v := &verification{
+		Fetcher:  f,
+		files:    map[string][]byte{},
+		worktree: map[string]string{},
+	}
+
+	finding := &verify.Finding{
+		Module:  m.Name(),
+		Details: map[string]interface{}{},
+	}
+
+	head, err := v.fetch("HEAD")
+	if err != nil {
+		return nil, err
+	}
+
+	head = bytes.TrimSpace(head)
+
+	var ref, commit string
+
+	switch {
+	case bytes.HasPrefix(head, []byte("ref: refs/")) && validPath(string(head[5:])):
+		ref = string(head[5:])
+		finding.Details["head"] = ref
+	case shaRegexp.Match(head):
+		commit = string(head)
+		finding.Details["head"] = commit
+	default:
+		return finding, nil
+	}
+
+	if data, err := v.fetch("config"); err != nil {
+		return nil, err
+	} else if bytes.Contains(data, []byte("[core]")) {
+		finding.Details["config"] = true
+
+		remotes := []string{}
+		for _, m := range remoteRegexp.FindAllSubmatch(data, -1) {
+			// remotes can contain credentials
+			remotes = append(remotes, secrets.RedactAll(string(m[1])))
+		}
+
+		if len(remotes) > 0 {
+			finding.Details["remotes"] = remotes
+		}
+	}
+
+	if ref != "" {
+		if commit, err = v.resolve(ref); err != nil {
+			return nil, err
+		}
+	}
+
+	if commit != "" {
+		finding.Details["commit"] = commit
+	}
+
+	if data, err := v.fetch("index"); err != nil {
+		return nil, err
+	} else if data == nil {
+	} else if entries, err := parseIndex(data); err == nil {
+		finding.Details["index_entries"] = len(entries)
+
+		files := []string{}
+		for i := 0; i < len(entries) && i < maxFiles; i++ {
+			files = append(files, entries[i].Path)
+		}
+
+		finding.Details["files"] = files
+		finding.Verified = len(entries) > 0
+	} else {
+		delete(v.files, "index")
+	}
+
+	if commit != "" {
+		if err := m.walk(v, commit); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(v.objects) > 0 {
+		finding.Details["objects"] = len(v.objects)
+		finding.Verified = true
+	} else if data, err := v.fetch("objects/info/packs"); err != nil {
+		return nil, err
+	} else if bytes.HasPrefix(data, []byte("P pack-")) {
+		// the objects are packed, the packs themselves are not fetched
+		finding.Details["packs"] = len(bytes.Split(bytes.TrimSpace(data), []byte{'\n'}))
+	}
+
+	if m.Dir != "" && finding.Verified {
+		if dir, err := m.reconstruct(host, v); err != nil {
+			finding.Details["reconstruct_error"] = err.Error()
+		} else {
+			finding.Details["reconstructed"] = dir
+		}
+	}
+
+	return finding, nil
+}
+
+// resolve returns the commit the ref points at, using the loose ref or
+// packed-refs.
+func (v *verification) resolve(ref string) (string, error) {
+	if data, err := v.fetch(ref); err != nil {
+		return "", err
+	} else if sha := string(bytes.TrimSpace(data)); shaRegexp.MatchString(sha) {
+		return sha, nil
+	} else {
+		delete(v.files, ref)
+	}
+
+	data, err := v.fetch("packed-refs")
+	if err != nil {
+		return "", err
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		parts := strings.Fields(scanner.Text())
+		if len(parts) != 2 || parts[1] != ref {
+			continue
+		}
+
+		if shaRegexp.MatchString(parts[0]) {
+			return parts[0], nil
+		}
+	}
+
+	return "", nil
+}
+
+// walk fetches the commit and its tree. Blobs are only fetched when the
+// repository will be reconstructed.
+func (m *Module) walk(v *verification, commit string) error {
+	o, err := v.fetchObject(commit)
+	if err != nil || o == nil || o.Type != "commit" {
+		return err
+	}
+
+	tree, err := commitTree(o)
+	if err != nil {
+		return nil
+	}
+
+	type item struct {
+		sha  string
+		path string
+	}
+
+	queue := []item{{tree, ""}}
+
+	for len(queue) > 0 && len(v.objects) < m.MaxObjects {
+		it := queue[0]
+		queue = queue[1:]
+
+		o, err := v.fetchObject(it.sha)
+		if err != nil {
+			return err
+		} else if o == nil || o.Type != "tree" {
+			continue
+		}
+
+		entries, err := parseTree(o)
+		if err != nil {
+			continue
+		}
+
+		for _, e := range entries {
+			if !validName(e.Name) {
+				continue
+			}
+
+			path := e.Name
+			if it.path != "" {
+				path = it.path + "/" + e.Name
+			}
+
+			if e.IsTree() {
+				queue = append(queue, item{e.SHA, path})
+			} else if !e.IsSubmodule() {
+				v.worktree[path] = e.SHA
+			}
+		}
+	}
+
+	if m.Dir == "" {
+		return nil
+	}
+
+	fetched := map[string]bool{}
+
+	for _, sha := range v.worktree {
+		if len(v.objects) >= m.MaxObjects {
+			break
+		} else if fetched[sha] {
+			continue
+		}
+
+		fetched[sha] = true
+
+		if _, err := v.fetchObject(sha); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// reconstruct writes the fetched repository to a directory for host,
+// including the files of the working tree that could be retrieved.
+func (m *Module) reconstruct(host string, v *verification) (string, error) {
+	root, err := safeJoin(m.Dir, host)
+	if err != nil {
+		return "", err
+	}
+
+	gitDir := filepath.Join(root, ".git")
+
+	for name, data := range v.files {
+		if err := writeFile(gitDir, name, data); err != nil {
+			return "", err
+		}
+	}
+
+	blobs := map[string]*object{}
+
+	for _, o := range v.objects {
+		name := fmt.Sprintf("objects/%s/%s", o.SHA[:2], o.SHA[2:])
+		if err := writeFile(gitDir, name, o.Raw); err != nil {
+			return "", err
+		}
+
+		if o.Type == "blob" {
+			blobs[o.SHA] = o
+		}
+	}
+
+	for path, sha := range v.worktree {
+		o, ok := blobs[sha]
+		if !ok {
+			continue
+		}
+
+		// never let the working tree overwrite the repository itself
+		if !validPath(path) {
+			continue
+		}
+
+		if err := writeFile(root, path, o.Data); err != nil {
+			return "", err
+		}
+	}
+
+	return root, nil
+}
+
+// validName returns false for tree entry names that could escape their
+// directory or write into the repository.
+func validName(name string) bool {
+	switch {
+	case name == "", name == ".", name == "..":
+		return false
+	case strings.Contains(name, "/"):
+		return false
+	case strings.EqualFold(name, ".git"):
+		return false
+	}
+
+	return true
+}
+
+// validPath returns whether all components of the path are valid names.
+func validPath(path string) bool {
+	for _, name := range strings.Split(path, "/") {
+		if !validName(name) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func writeFile(root, name string, data []byte) error {
+	path, err := safeJoin(root, name)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// safeJoin joins name to root, names escaping root are refused as they are
+// controlled by the scanned host.
+func safeJoin(root, name string) (string, error) {
+	root = filepath.Clean(root)
+
+	path := filepath.Join(root, filepath.FromSlash(name))
+	if !strings.HasPrefix(path, root+string(filepath.Separator)) {
+		return "", fmt.Errorf("Refusing to write outside of %s: %s", root, name)
+	}
+
+	return path, nil
+}
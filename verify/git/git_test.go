@@ -0,0 +1,44 @@
+package git
+
+import "testing"
+
+func TestCommitTree(t *testing.T) {
+	tree := "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+
+	o := &object{SHA: "c", Type: "commit", Data: []byte("tree " + tree + "\nauthor a\n\nmessage\n")}
+	if sha, err := commitTree(o); err != nil || sha != tree {
+		t.Fatalf("expected %s, got %s (%v)", tree, sha, err)
+	}
+
+	o = &object{SHA: "c", Type: "commit", Data: []byte("tree a\n\nmessage\n")}
+	if _, err := commitTree(o); err == nil {
+		t.Fatal("expected an error for an invalid tree")
+	}
+}
+
+func TestFetchObjectInvalidName(t *testing.T) {
+	v := &verification{}
+
+	if _, err := v.fetchObject("a"); err == nil {
+		t.Fatal("expected an error for an invalid object name")
+	}
+}
+
+func TestValidPath(t *testing.T) {
+	for path, valid := range map[string]bool{
+		"README.md":                       true,
+		"src/main.go":                     true,
+		".gitignore":                      true,
+		".git/config":                     false,
+		".GIT/hooks/post-checkout":        false,
+		"sub/../.git/hooks/post-checkout": false,
+		"sub/.git/config":                 false,
+		"./file":                          false,
+		"a//b":                            false,
+		"":                                false,
+	} {
+		if validPath(path) != valid {
+			t.Errorf("validPath(%q) should be %v", path, valid)
+		}
+	}
+}
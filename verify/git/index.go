@@ -0,0 +1,128 @@
+package git
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+)
+
+type indexEntry struct {
+	Path string
+	SHA  string
+	Mode uint32
+}
+
+// parseIndex parses a .git/index file, versions 2 to 4 are supported.
+func parseIndex(data []byte) ([]indexEntry, error) {
+	if len(data) < 12 || !bytes.Equal(data[:4], []byte("DIRC")) {
+		return nil, errors.New("Not a git index.")
+	}
+
+	version := binary.BigEndian.Uint32(data[4:8])
+	if version < 2 || version > 4 {
+		return nil, fmt.Errorf("Unsupported index version %d.", version)
+	}
+
+	count := binary.BigEndian.Uint32(data[8:12])
+
+	entries := []indexEntry{}
+
+	offset := 12
+	prev := ""
+
+	for i := uint32(0); i < count; i++ {
+		start := offset
+
+		if offset+62 > len(data) {
+			return entries, errors.New("Index is truncated.")
+		}
+
+		mode := binary.BigEndian.Uint32(data[offset+24 : offset+28])
+		sha := hex.EncodeToString(data[offset+40 : offset+60])
+		flags := binary.BigEndian.Uint16(data[offset+60 : offset+62])
+
+		offset += 62
+
+		if version >= 3 && flags&0x4000 != 0 {
+			offset += 2
+		}
+
+		if offset > len(data) {
+			return entries, errors.New("Index is truncated.")
+		}
+
+		var path string
+
+		if version == 4 {
+			strip, n := readOffset(data[offset:])
+			if n == 0 || strip < 0 || strip > len(prev) {
+				return entries, errors.New("Index is corrupt.")
+			}
+
+			offset += n
+
+			nul := bytes.IndexByte(data[offset:], 0)
+			if nul == -1 {
+				return entries, errors.New("Index is truncated.")
+			}
+
+			path = prev[:len(prev)-strip] + string(data[offset:offset+nul])
+			offset += nul + 1
+		} else {
+			nul := bytes.IndexByte(data[offset:], 0)
+			if nul == -1 {
+				return entries, errors.New("Index is truncated.")
+			}
+
+			path = string(data[offset : offset+nul])
+
+			// entries are padded with nuls to a multiple of eight bytes
+			offset += nul + 1
+			for (offset-start)%8 != 0 {
+				offset++
+			}
+		}
+
+		entries = append(entries, indexEntry{
+			Path: path,
+			SHA:  sha,
+			Mode: mode,
+		})
+
+		prev = path
+	}
+
+	return entries, nil
+}
+
+// readOffset reads the variable length integer used by index version 4.
+// Values that would overflow return 0 bytes read.
+func readOffset(data []byte) (int, int) {
+	if len(data) == 0 {
+		return 0, 0
+	}
+
+	c := data[0]
+	val := int(c & 0x7f)
+
+	n := 1
+	for c&0x80 != 0 {
+		if n >= len(data) {
+			return 0, 0
+		}
+
+		if val > math.MaxInt32>>7 {
+			return 0, 0
+		}
+
+		c = data[n]
+		n++
+
+		val = ((val + 1) << 7) | int(c&0x7f)
+	}
+
+	return val, n
+}
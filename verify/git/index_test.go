@@ -0,0 +1,63 @@
+package git
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// indexHeader returns the header of an index with a single entry.
+func indexHeader(version uint32) []byte {
+	data := []byte("DIRC")
+	data = binary.BigEndian.AppendUint32(data, version)
+	data = binary.BigEndian.AppendUint32(data, 1)
+	return data
+}
+
+// indexEntryData returns the fixed part of an entry with the flags.
+func indexEntryData(flags uint16) []byte {
+	data := make([]byte, 62)
+	binary.BigEndian.PutUint32(data[24:], 0100644)
+	data[40] = 0xab
+	binary.BigEndian.PutUint16(data[60:], flags)
+	return data
+}
+
+func TestParseIndex(t *testing.T) {
+	data := append(indexHeader(2), indexEntryData(8)...)
+	data = append(data, "file.txt\x00\x00\x00\x00\x00\x00\x00\x00"...)
+
+	entries, err := parseIndex(data)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(entries) != 1 || entries[0].Path != "file.txt" || entries[0].Mode != 0100644 {
+		t.Fatalf("unexpected entries %+v", entries)
+	} else if entries[0].SHA[:2] != "ab" {
+		t.Fatalf("unexpected sha %s", entries[0].SHA)
+	}
+}
+
+func TestParseIndexTruncatedExtendedFlags(t *testing.T) {
+	// the extended flags would end beyond the data
+	data := append(indexHeader(3), indexEntryData(0x4000)...)
+
+	if _, err := parseIndex(data); err == nil {
+		t.Fatal("expected an error for a truncated index")
+	}
+}
+
+func TestParseIndexInvalidStrip(t *testing.T) {
+	for _, strip := range [][]byte{
+		// longer than the previous path
+		{0x05},
+		// overflowing varint
+		{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x7f},
+	} {
+		data := append(indexHeader(4), indexEntryData(0)...)
+		data = append(data, strip...)
+		data = append(data, "file.txt\x00"...)
+
+		if _, err := parseIndex(data); err == nil {
+			t.Fatalf("expected an error for strip %x", strip)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package git
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+)
+
+// maximum size of an inflated object
+const maxObjectSize = 16 << 20
+
+type object struct {
+	SHA  string
+	Type string
+	Data []byte
+
+	// Raw contains the compressed object, as stored in .git/objects
+	Raw []byte
+}
+
+// parseObject inflates a loose object and verifies it hashes to sha.
+func parseObject(sha string, raw []byte) (*object, error) {
+	zr, err := zlib.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+
+	defer zr.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(zr, maxObjectSize))
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha1.Sum(data)
+	if hex.EncodeToString(sum[:]) != sha {
+		return nil, fmt.Errorf("Object %s has an invalid hash.", sha)
+	}
+
+	i := bytes.IndexByte(data, 0)
+	if i == -1 {
+		return nil, errors.New("Object header not terminated.")
+	}
+
+	header := bytes.SplitN(data[:i], []byte{' '}, 2)
+	if len(header) != 2 {
+		return nil, errors.New("Invalid object header.")
+	}
+
+	size, err := strconv.Atoi(string(header[1]))
+	if err != nil {
+		return nil, errors.New("Invalid object size.")
+	}
+
+	o := &object{
+		SHA:  sha,
+		Type: string(header[0]),
+		Data: data[i+1:],
+		Raw:  raw,
+	}
+
+	if size != len(o.Data) {
+		return nil, fmt.Errorf("Object %s has an invalid size.", sha)
+	}
+
+	switch o.Type {
+	case "commit", "tree", "blob", "tag":
+	default:
+		return nil, fmt.Errorf("Object %s has unknown type %s.", sha, o.Type)
+	}
+
+	return o, nil
+}
+
+// commitTree returns the tree of a commit.
+func commitTree(o *object) (string, error) {
+	for _, line := range bytes.Split(o.Data, []byte{'\n'}) {
+		if len(line) == 0 {
+			break
+		}
+
+		if !bytes.HasPrefix(line, []byte("tree ")) {
+		} else if sha := string(line[5:]); !shaRegexp.MatchString(sha) {
+			return "", fmt.Errorf("Commit %s has an invalid tree.", o.SHA)
+		} else {
+			return sha, nil
+		}
+	}
+
+	return "", fmt.Errorf("Commit %s has no tree.", o.SHA)
+}
+
+type treeEntry struct {
+	Mode string
+	Name string
+	SHA  string
+}
+
+func (e treeEntry) IsTree() bool {
+	return e.Mode == "40000"
+}
+
+func (e treeEntry) IsSubmodule() bool {
+	return e.Mode == "160000"
+}
+
+func parseTree(o *object) ([]treeEntry, error) {
+	entries := []treeEntry{}
+
+	data := o.Data
+	for len(data) > 0 {
+		sp := bytes.IndexByte(data, ' ')
+		if sp == -1 {
+			return nil, fmt.Errorf("Tree %s is corrupt.", o.SHA)
+		}
+
+		nul := bytes.IndexByte(data[sp:], 0)
+		if nul == -1 || sp+nul+21 > len(data) {
+			return nil, fmt.Errorf("Tree %s is corrupt.", o.SHA)
+		}
+
+		nul += sp
+
+		entries = append(entries, treeEntry{
+			Mode: string(data[:sp]),
+			Name: string(data[sp+1 : nul]),
+			SHA:  hex.EncodeToString(data[nul+1 : nul+21]),
+		})
+
+		data = data[nul+21:]
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,165 @@
+package svn
+
+import (
+	"bytes"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/dutchcoders/anam/verify"
+)
+
+// field positions within an entry of the entries file
+const (
+	fieldName = iota
+	fieldKind
+	fieldRevision
+	fieldURL
+	fieldRoot
+	fieldSchedule
+	fieldTextTime
+	fieldChecksum
+	fieldCommittedDate
+	fieldCommittedRevision
+	fieldLastAuthor
+)
+
+type entry []string
+
+func (e entry) field(i int) string {
+	if i >= len(e) {
+		return ""
+	}
+
+	return e[i]
+}
+
+// parseEntries parses the entries file of format 8 to 10. The first entry
+// describes the directory itself.
+func parseEntries(data []byte) (int, []entry, error) {
+	parts := bytes.Split(data, []byte("\f\n"))
+	if len(parts) < 2 {
+		return 0, nil, errors.New("Entries file contains no entries.")
+	}
+
+	lines := bytes.SplitN(parts[0], []byte{'\n'}, 2)
+
+	format, err := strconv.Atoi(string(bytes.TrimSpace(lines[0])))
+	if err != nil {
+		return 0, nil, errors.New("Entries file has an invalid format.")
+	}
+
+	// the first entry follows the format line
+	if len(lines) == 2 {
+		parts[0] = lines[1]
+	} else {
+		parts[0] = nil
+	}
+
+	entries := []entry{}
+
+	for _, part := range parts {
+		if len(part) == 0 {
+			continue
+		}
+
+		entries = append(entries, entry(strings.Split(string(part), "\n")))
+	}
+
+	if len(entries) == 0 || entries[0].field(fieldKind) != "dir" {
+		return 0, nil, errors.New("Entries file has no directory entry.")
+	}
+
+	return format, entries, nil
+}
+
+// walkEntries parses the entries of the root and fetches the entries of
+// its subdirectories.
+func (m *Module) walkEntries(f verify.Fetcher, data []byte) (*workingCopy, error) {
+	format, entries, err := parseEntries(data)
+	if err != nil {
+		return nil, nil
+	}
+
+	root := entries[0]
+
+	wc := &workingCopy{
+		Format: format,
+		URL:    root.field(fieldURL),
+		Root:   root.field(fieldRoot),
+		Author: root.field(fieldLastAuthor),
+		Files:  []string{},
+	}
+
+	wc.Revision, _ = strconv.Atoi(root.field(fieldRevision))
+
+	queue := []string{""}
+
+	for len(queue) > 0 && wc.Dirs < maxDirectories {
+		dir := queue[0]
+		queue = queue[1:]
+
+		if dir != "" {
+			status, data, err := f.Fetch("/" + escapePath(dir) + "/.svn/entries")
+			if err != nil {
+				return nil, err
+			} else if status != 200 {
+				continue
+			}
+
+			if _, entries, err = parseEntries(data); err != nil {
+				continue
+			}
+		}
+
+		wc.Dirs++
+
+		for _, e := range entries[1:] {
+			name := e.field(fieldName)
+			if !validName(name) {
+				continue
+			}
+
+			path := name
+			if dir != "" {
+				path = dir + "/" + name
+			}
+
+			switch e.field(fieldKind) {
+			case "file":
+				wc.Files = append(wc.Files, path)
+			case "dir":
+				queue = append(queue, path)
+			}
+		}
+	}
+
+	return wc, nil
+}
+
+// validName returns false for entry names that could escape their directory
+// or break the request line, names are controlled by the scanned host.
+func validName(name string) bool {
+	if name == "" || name == "." || name == ".." || strings.Contains(name, "/") {
+		return false
+	}
+
+	for _, r := range name {
+		if r < 0x20 || r == 0x7f {
+			return false
+		}
+	}
+
+	return true
+}
+
+// escapePath escapes every segment of the path.
+func escapePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i := range segments {
+		segments[i] = url.PathEscape(segments[i])
+	}
+
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,112 @@
+// Package svn verifies exposed subversion working copies, by parsing the
+// legacy .svn/entries files and the wc.db database of subversion 1.7 and
+// later.
+package svn
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+
+	"github.com/dutchcoders/anam/verify"
+)
+
+const (
+	// amount of file names to include in a finding
+	maxFiles = 25
+
+	// maximum amount of directories to fetch entries for
+	maxDirectories = 100
+)
+
+// Module verifies exposed .svn directories.
+type Module struct {
+}
+
+func New() *Module {
+	return &Module{}
+}
+
+func (m *Module) Name() string {
+	return "svn"
+}
+
+func (m *Module) Applies(path string) bool {
+	return strings.HasPrefix(path, "/.svn/")
+}
+
+// workingCopy is the information extracted from the working copy.
+type workingCopy struct {
+	Format   int
+	URL      string
+	Root     string
+	Revision int
+	Author   string
+	Files    []string
+	Dirs     int
+}
+
+func (m *Module) Verify(host string, f verify.Fetcher) (*verify.Finding, error) {
+	finding := &verify.Finding{
+		Module:  m.Name(),
+		Details: map[string]interface{}{},
+	}
+
+	status, data, err := f.Fetch("/.svn/entries")
+	if err != nil {
+		return nil, err
+	} else if status != 200 {
+		data = nil
+	}
+
+	format := 0
+	if line := bytes.SplitN(data, []byte{'\n'}, 2); len(line) == 2 {
+		format, _ = strconv.Atoi(string(bytes.TrimSpace(line[0])))
+	}
+
+	var wc *workingCopy
+
+	switch {
+	case format >= 8 && format <= 10:
+		if wc, err = m.walkEntries(f, data); err != nil {
+			return nil, err
+		}
+	default:
+		// entries is empty or contains just the format since 1.7, the
+		// working copy is stored in wc.db
+		status, data, err := f.Fetch("/.svn/wc.db")
+		if err != nil {
+			return nil, err
+		} else if status != 200 {
+			return finding, nil
+		}
+
+		if wc, err = parseDatabase(data); err != nil {
+			finding.Details["error"] = err.Error()
+			return finding, nil
+		}
+	}
+
+	if wc == nil {
+		return finding, nil
+	}
+
+	finding.Verified = wc.URL != "" || len(wc.Files) > 0
+
+	finding.Details["format"] = wc.Format
+	finding.Details["url"] = wc.URL
+	finding.Details["root"] = wc.Root
+	finding.Details["revision"] = wc.Revision
+	finding.Details["last_author"] = wc.Author
+	finding.Details["file_count"] = len(wc.Files)
+	finding.Details["dir_count"] = wc.Dirs
+
+	files := wc.Files
+	if len(files) > maxFiles {
+		files = files[:maxFiles]
+	}
+
+	finding.Details["files"] = files
+
+	return finding, nil
+}
@@ -0,0 +1,181 @@
+package svn
+
+import (
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// fetcher serves the files of testdata by path and records the requests.
+type fetcher struct {
+	files    map[string]string
+	requests []string
+}
+
+func (f *fetcher) Fetch(path string) (int, []byte, error) {
+	f.requests = append(f.requests, path)
+
+	name, ok := f.files[path]
+	if !ok {
+		return 404, nil, nil
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	return 200, data, err
+}
+
+func TestParseEntries(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/entries")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	format, entries, err := parseEntries(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if format != 10 {
+		t.Errorf("format is %d, should be 10", format)
+	}
+
+	root := entries[0]
+	if url := root.field(fieldURL); url != "http://svn.example.com/repo/trunk" {
+		t.Errorf("url is %s", url)
+	} else if author := root.field(fieldLastAuthor); author != "alice" {
+		t.Errorf("last author is %s", author)
+	} else if len(entries) != 7 {
+		t.Errorf("got %d entries, should be 7", len(entries))
+	}
+
+	for _, data := range []string{"", "12\n", "x\n\ndir\n\f\n", "10\n\nfile\n\f\n"} {
+		if _, _, err := parseEntries([]byte(data)); err == nil {
+			t.Errorf("parseEntries(%q) should fail", data)
+		}
+	}
+}
+
+func TestWalkEntries(t *testing.T) {
+	f := &fetcher{
+		files: map[string]string{
+			"/lib/.svn/entries": "entries-lib",
+		},
+	}
+
+	data, err := ioutil.ReadFile("testdata/entries")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wc, err := New().walkEntries(f, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if wc.Revision != 42 || wc.Root != "http://svn.example.com/repo" {
+		t.Errorf("unexpected working copy %+v", wc)
+	}
+
+	if expected := []string{"index.php", "lib/config.php"}; !reflect.DeepEqual(wc.Files, expected) {
+		t.Errorf("files are %v, should be %v", wc.Files, expected)
+	}
+
+	// names with control characters and .. are never requested, others
+	// are escaped
+	if expected := []string{"/lib/.svn/entries", "/a%20b%3Fc%23d/.svn/entries"}; !reflect.DeepEqual(f.requests, expected) {
+		t.Errorf("requested %q, should be %q", f.requests, expected)
+	}
+}
+
+// database creates a wc.db of the format, with the tables and columns
+// the module reads.
+func database(t *testing.T, dir string, format int) []byte {
+	path := filepath.Join(dir, fmt.Sprintf("wc-%d.db", format))
+
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	for _, stmt := range []string{
+		fmt.Sprintf("PRAGMA user_version = %d", format),
+		"CREATE TABLE repository (id INTEGER PRIMARY KEY, root TEXT, uuid TEXT)",
+		"CREATE TABLE nodes (local_relpath TEXT, op_depth INTEGER, repos_path TEXT, kind TEXT, changed_revision INTEGER, changed_author TEXT)",
+		"INSERT INTO repository VALUES (1, 'https://svn.example.com/repo', 'uuid')",
+		"INSERT INTO nodes VALUES ('', 0, 'trunk', 'dir', 40, 'alice')",
+		"INSERT INTO nodes VALUES ('index.php', 0, 'trunk/index.php', 'file', 42, 'bob')",
+		"INSERT INTO nodes VALUES ('lib', 0, 'trunk/lib', 'dir', 41, 'alice')",
+		"INSERT INTO nodes VALUES ('lib/config.php', 0, 'trunk/lib/config.php', 'file', 41, 'alice')",
+		"INSERT INTO nodes VALUES ('new.php', 1, NULL, 'file', NULL, NULL)",
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	db.Close()
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return data
+}
+
+func TestParseDatabase(t *testing.T) {
+	dir, err := ioutil.TempDir("", "svn")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	for _, format := range []int{29, 31} {
+		wc, err := parseDatabase(database(t, dir, format))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := &workingCopy{
+			Format:   format,
+			URL:      "https://svn.example.com/repo/trunk",
+			Root:     "https://svn.example.com/repo",
+			Revision: 42,
+			Author:   "bob",
+			Files:    []string{"index.php", "lib/config.php"},
+			Dirs:     2,
+		}
+
+		if !reflect.DeepEqual(wc, expected) {
+			t.Errorf("format %d: got %+v, should be %+v", format, wc, expected)
+		}
+	}
+
+	if _, err := parseDatabase([]byte("not a database")); err == nil {
+		t.Error("invalid database should fail")
+	}
+}
+
+func TestValidName(t *testing.T) {
+	for name, valid := range map[string]bool{
+		"index.php": true,
+		"a b":       true,
+		"":          false,
+		".":         false,
+		"..":        false,
+		"a/b":       false,
+		"a\r\nb":    false,
+		"a\x00":     false,
+	} {
+		if validName(name) != valid {
+			t.Errorf("validName(%q) should be %v", name, valid)
+		}
+	}
+}
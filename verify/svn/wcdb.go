@@ -0,0 +1,91 @@
+package svn
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// parseDatabase extracts the working copy from a wc.db sqlite database, as
+// used since subversion 1.7.
+func parseDatabase(data []byte) (*workingCopy, error) {
+	tmp, err := ioutil.TempFile("", "anam-wc.db")
+	if err != nil {
+		return nil, err
+	}
+
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open("sqlite3", "file:"+tmp.Name()+"?mode=ro")
+	if err != nil {
+		return nil, err
+	}
+
+	defer db.Close()
+
+	wc := &workingCopy{
+		Files: []string{},
+	}
+
+	// the format of the working copy is the user version of the database
+	if err := db.QueryRow("PRAGMA user_version").Scan(&wc.Format); err != nil {
+		return nil, err
+	}
+
+	if err := db.QueryRow("SELECT root FROM repository ORDER BY id LIMIT 1").Scan(&wc.Root); err != nil {
+		return nil, err
+	}
+
+	var reposPath sql.NullString
+	if err := db.QueryRow("SELECT repos_path FROM nodes WHERE local_relpath = '' AND op_depth = 0").Scan(&reposPath); err == nil {
+		wc.URL = wc.Root
+		if reposPath.String != "" {
+			wc.URL += "/" + reposPath.String
+		}
+	}
+
+	rows, err := db.Query("SELECT local_relpath, kind, changed_revision, changed_author FROM nodes WHERE op_depth = 0 ORDER BY local_relpath")
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			path     string
+			kind     string
+			revision sql.NullInt64
+			author   sql.NullString
+		)
+
+		if err := rows.Scan(&path, &kind, &revision, &author); err != nil {
+			return nil, err
+		}
+
+		if int(revision.Int64) > wc.Revision {
+			wc.Revision = int(revision.Int64)
+			wc.Author = author.String
+		}
+
+		switch kind {
+		case "file":
+			wc.Files = append(wc.Files, path)
+		case "dir":
+			wc.Dirs++
+		}
+	}
+
+	return wc, rows.Err()
+}
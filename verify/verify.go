@@ -0,0 +1,23 @@
+// Package verify defines the follow-up modules that verify a hit, by
+// requesting additional files over the same connection.
+package verify
+
+// Fetcher requests additional paths from the host being scanned.
+type Fetcher interface {
+	Fetch(path string) (status int, body []byte, err error)
+}
+
+// Finding is the outcome of a verification module.
+type Finding struct {
+	Module   string                 `json:"module"`
+	Verified bool                   `json:"verified"`
+	Details  map[string]interface{} `json:"details,omitempty"`
+}
+
+// Module verifies hits for the paths it applies to. Modules run at most
+// once per host.
+type Module interface {
+	Name() string
+	Applies(path string) bool
+	Verify(host string, f Fetcher) (*Finding, error)
+}